@@ -6,9 +6,12 @@
 package main
 
 import (
+	"github.com/onosproject/discovery-agent/pkg/discovery"
 	"github.com/onosproject/discovery-agent/pkg/manager"
 	"github.com/onosproject/onos-lib-go/pkg/cli"
+	"github.com/onosproject/onos-lib-go/pkg/errors"
 	"github.com/onosproject/onos-lib-go/pkg/logging"
+	"github.com/onosproject/onos-lib-go/pkg/northbound"
 	"github.com/spf13/cobra"
 )
 
@@ -17,6 +20,15 @@ var log = logging.GetLogger()
 const (
 	uuidFlag          = "uuid"
 	targetAddressFlag = "target-address"
+	peerAddressFlag   = "peer-address"
+	peerTokenPathFlag = "peer-token-path"
+
+	targetCACertPathFlag = "target-tls-ca-cert-path"
+	targetCertPathFlag   = "target-tls-cert-path"
+	targetKeyPathFlag    = "target-tls-key-path"
+	targetServerNameFlag = "target-tls-server-name"
+
+	authenticationFlag = "authentication-enabled"
 )
 
 // The main entry point
@@ -27,6 +39,13 @@ func main() {
 	}
 	cmd.Flags().String(uuidFlag, "", "externally assigned UUID of this agent; if omitted, one will be auto-generated")
 	cmd.Flags().String(targetAddressFlag, "", "address:port or just :port of the stratum agent")
+	cmd.Flags().StringSlice(peerAddressFlag, nil, "address:port of the gNMI server of a redundant peer agent for the same stratum agent")
+	cmd.Flags().String(peerTokenPathFlag, "", "path to file with the JWT bearer token for the gNMI servers of peer agents; required with --peer-address if --authentication-enabled is set, as the peers then require it as well")
+	cmd.Flags().String(targetCACertPathFlag, "", "path to CA certificate bundle for verifying the stratum agent")
+	cmd.Flags().String(targetCertPathFlag, "", "path to client certificate for connecting to the stratum agent")
+	cmd.Flags().String(targetKeyPathFlag, "", "path to client private key for connecting to the stratum agent")
+	cmd.Flags().String(targetServerNameFlag, "", "server name override for verifying the stratum agent certificate")
+	cmd.Flags().Bool(authenticationFlag, false, "if set, require OpenID Connect (JWT) bearer tokens on the link agent gNMI service, in addition to client certificates; cannot be used with --no-tls")
 	cli.AddServiceEndpointFlags(cmd, "link agent gNMI")
 	cli.Run(cmd)
 }
@@ -34,17 +53,42 @@ func main() {
 func runRootCommand(cmd *cobra.Command, args []string) error {
 	agentUUID, _ := cmd.Flags().GetString(uuidFlag)
 	targetAddress, _ := cmd.Flags().GetString(targetAddressFlag)
+	peerAddresses, _ := cmd.Flags().GetStringSlice(peerAddressFlag)
+	peerTokenPath, _ := cmd.Flags().GetString(peerTokenPathFlag)
+	targetTLS := discovery.TLSConfig{}
+	targetTLS.CACertPath, _ = cmd.Flags().GetString(targetCACertPathFlag)
+	targetTLS.CertPath, _ = cmd.Flags().GetString(targetCertPathFlag)
+	targetTLS.KeyPath, _ = cmd.Flags().GetString(targetKeyPathFlag)
+	targetTLS.ServerName, _ = cmd.Flags().GetString(targetServerNameFlag)
+	securityCfg := northbound.SecurityConfig{}
+	securityCfg.AuthenticationEnabled, _ = cmd.Flags().GetBool(authenticationFlag)
 
 	flags, err := cli.ExtractServiceEndpointFlags(cmd)
 	if err != nil {
 		return err
 	}
 
+	// Server config derived from the flags drops the security config without TLS, which would silently disable
+	// authentication; besides, bearer tokens must not be sent in the clear
+	if securityCfg.AuthenticationEnabled && flags.NoTLS {
+		return errors.NewInvalid("--%s cannot be used with --no-tls, as authentication requires TLS", authenticationFlag)
+	}
+
+	// Peers serve gNMI with the same security settings, so they will reject requests that carry no token
+	if securityCfg.AuthenticationEnabled && len(peerAddresses) > 0 && len(peerTokenPath) == 0 {
+		return errors.NewInvalid("--%s requires --%s, as peer agents require bearer tokens when --%s is set",
+			peerAddressFlag, peerTokenPathFlag, authenticationFlag)
+	}
+
 	log.Infof("Starting discovery-agent")
 	cfg := manager.Config{
-		AgentUUID:     agentUUID,
-		TargetAddress: targetAddress,
-		ServiceFlags:  flags,
+		AgentUUID:      agentUUID,
+		TargetAddress:  targetAddress,
+		PeerAddresses:  peerAddresses,
+		PeerTokenPath:  peerTokenPath,
+		TargetTLS:      targetTLS,
+		ServiceFlags:   flags,
+		SecurityConfig: securityCfg,
 	}
 	return cli.RunDaemon(manager.NewManager(cfg))
 }
@@ -14,8 +14,11 @@ require (
 require (
 	github.com/google/gopacket v1.1.19
 	github.com/google/uuid v1.2.0
+	github.com/onosproject/onos-api/go v0.10.21
 	github.com/spf13/viper v1.11.0
 	github.com/stretchr/testify v1.7.1
+	google.golang.org/genproto v0.0.0-20220608133413-ed9918b62aac
+	google.golang.org/protobuf v1.28.0
 )
 
 require (
@@ -44,7 +47,6 @@ require (
 	github.com/magiconair/properties v1.8.6 // indirect
 	github.com/mitchellh/go-homedir v1.1.0 // indirect
 	github.com/mitchellh/mapstructure v1.4.3 // indirect
-	github.com/onosproject/onos-api/go v0.10.21 // indirect
 	github.com/pelletier/go-toml v1.9.4 // indirect
 	github.com/pelletier/go-toml/v2 v2.0.0-beta.8 // indirect
 	github.com/pierrec/lz4 v2.6.1+incompatible // indirect
@@ -65,8 +67,6 @@ require (
 	golang.org/x/sys v0.0.0-20220503163025-988cb79eb6c6 // indirect
 	golang.org/x/text v0.3.7 // indirect
 	google.golang.org/appengine v1.6.7 // indirect
-	google.golang.org/genproto v0.0.0-20220608133413-ed9918b62aac // indirect
-	google.golang.org/protobuf v1.28.0 // indirect
 	gopkg.in/ini.v1 v1.66.4 // indirect
 	gopkg.in/square/go-jose.v1 v1.1.2 // indirect
 	gopkg.in/square/go-jose.v2 v2.5.1 // indirect
@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Ethernet type of the broadcast-destination LLDP packets, which are forwarded by bridges unlike plain LLDP packets
+const ethernetTypeBDDP layers.EthernetType = 0x8942
+
+// Returns true if BDDP packets are to be emitted next to LLDP packets
+func (c *Controller) emitsBDDP() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.config.BDDP
+}
+
+// Produces BDDP packet advertising the given port of this agent, with the given TTL and probe sequence number
+func (c *Controller) bddpPacket(portNumber uint32, ttl uint16, sequence uint32) ([]byte, error) {
+	return c.discoveryPacket(ethernetTypeBDDP, portNumber, ttl, sequence)
+}
+
+// Processes the LLDP payload of the BDDP packet received on the given ingress port and VLAN, updating the
+// corresponding link
+func (c *Controller) processBDDPPacket(ingressPort uint32, vlan string, payload []byte) {
+	if !c.emitsBDDP() {
+		return
+	}
+	rawPacket := gopacket.NewPacket(payload, layers.LayerTypeLinkLayerDiscovery, gopacket.Default)
+	if rawPacket.Layer(layers.LayerTypeLinkLayerDiscovery) == nil {
+		log.Warnf("Ignoring malformed BDDP packet on port %d", ingressPort)
+		return
+	}
+	c.processDiscoveryPacket(ingressPort, vlan, rawPacket, true)
+}
+
+// Updates whether the given link is indirect, per whether it was just refreshed via BDDP or LLDP; links refreshed
+// only via BDDP within their max age are indirect, as bridges between the neighbors consume the LLDP packets
+func (c *Controller) updateLinkIndirection(key linkKey, bddp bool) {
+	if !c.emitsBDDP() {
+		return
+	}
+	c.lock.Lock()
+	link, ok := c.links[key]
+	if !ok {
+		c.lock.Unlock()
+		return
+	}
+	now := c.now()
+	if !bddp {
+		link.lastDirectUpdate = now
+	}
+	maxAge := c.maxLinkAge(link)
+	indirect := link.lastDirectUpdate.IsZero() || (maxAge > 0 && link.lastDirectUpdate.Before(now.Add(-maxAge)))
+	c.lock.Unlock()
+	c.setLinkIndirect(key, indirect)
+}
+
+// Updates whether the given link is indirect, publishing the change
+func (c *Controller) setLinkIndirect(key linkKey, indirect bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	link, ok := c.links[key]
+	if !ok || (link.Indirect != nil && *link.Indirect == indirect) {
+		return
+	}
+	link.Indirect = &indirect
+	if !c.isLinkSuppressed(key) {
+		c.updateTree(treeLeaf{c.linkPath(key) + "/indirect", boolVal(indirect)})
+	}
+}
@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Returns the LLDP payload of the BDDP packet emitted by the given agent on the given port with the given probe
+// sequence number
+func newAgentBDDPPayload(t *testing.T, agent *Controller, portNumber uint32, sequence uint32) []byte {
+	bytes, err := agent.bddpPacket(portNumber, 30, sequence)
+	assert.NoError(t, err)
+	packet := gopacket.NewPacket(bytes, layers.LayerTypeEthernet, gopacket.Default)
+	eth := packet.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+	assert.Equal(t, ethernetTypeBDDP, eth.EthernetType)
+	return eth.LayerPayload()
+}
+
+func TestController_IndirectLinks(t *testing.T) {
+	c, clock := newTestController(t)
+	neighbor, _ := newTestController(t)
+	neighbor.IngressDeviceID = "foo"
+	path := "state/link[port=1,device=foo,egress-port=10]/indirect"
+
+	// BDDP should be ignored unless enabled
+	c.processBDDPPacket(1, "", newAgentBDDPPayload(t, neighbor, 10, 1))
+	assert.Len(t, c.GetLinks(), 0)
+
+	// Links learned only via BDDP are indirect
+	c.config.BDDP = true
+	c.processBDDPPacket(1, "", newAgentBDDPPayload(t, neighbor, 10, neighbor.nextProbeSequence()))
+	links := c.GetLinks()
+	assert.Len(t, links, 1)
+	assert.True(t, *links[0].Indirect)
+	assert.True(t, c.Root().GetPath(path).Value().GetBoolVal())
+
+	// Links learned via LLDP are direct, even if refreshed via BDDP as well
+	c.processLLDPPacket(1, newAgentLLDPPacket(t, neighbor, 10, 30))
+	assert.False(t, *c.GetLinks()[0].Indirect)
+	// Probe received via both LLDP and BDDP should count only once
+	c.processBDDPPacket(1, "", newAgentBDDPPayload(t, neighbor, 10, neighbor.probeSequence))
+	assert.False(t, *c.GetLinks()[0].Indirect)
+	assert.False(t, c.Root().GetPath(path).Value().GetBoolVal())
+	assert.Equal(t, int64(2), c.GetLinks()[0].ProbesReceived)
+
+	// Once LLDP is no longer received, the link becomes indirect
+	clock.advance(31 * time.Second)
+	c.processBDDPPacket(1, "", newAgentBDDPPayload(t, neighbor, 10, neighbor.nextProbeSequence()))
+	assert.True(t, *c.GetLinks()[0].Indirect)
+	assert.True(t, c.Root().GetPath(path).Value().GetBoolVal())
+}
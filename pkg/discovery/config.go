@@ -10,7 +10,11 @@ import (
 	"github.com/onosproject/onos-net-lib/pkg/gnmiutils"
 	"github.com/openconfig/gnmi/proto/gnmi"
 	"github.com/spf13/viper"
+	"net"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -18,11 +22,64 @@ var configFile = "/etc/discovery-agent/config.yaml" // not a constant for testin
 
 // Config contains configuration parameters for the link discovery
 type Config struct {
-	EmitFrequency               int64 `mapstructure:"emitFrequency" yaml:"emitFrequency"`
-	MaxLinkAge                  int64 `mapstructure:"maxLinkAge" yaml:"maxLinkAge"`
-	PipelineValidationFrequency int64 `mapstructure:"pipelineValidationFrequency" yaml:"pipelineValidationFrequency"`
-	PortRediscoveryFrequency    int64 `mapstructure:"portRediscoveryFrequency" yaml:"portRediscoveryFrequency"`
-	LinkPruneFrequency          int64 `mapstructure:"linkPruneFrequency" yaml:"linkPruneFrequency"`
+	EmitFrequency               int64  `mapstructure:"emitFrequency" yaml:"emitFrequency"`
+	MaxLinkAge                  int64  `mapstructure:"maxLinkAge" yaml:"maxLinkAge"`
+	MaxHostAge                  int64  `mapstructure:"maxHostAge" yaml:"maxHostAge"`
+	PipelineValidationFrequency int64  `mapstructure:"pipelineValidationFrequency" yaml:"pipelineValidationFrequency"`
+	PortRediscoveryFrequency    int64  `mapstructure:"portRediscoveryFrequency" yaml:"portRediscoveryFrequency"`
+	LinkPruneFrequency          int64  `mapstructure:"linkPruneFrequency" yaml:"linkPruneFrequency"`
+	RetryMinPause               int64  `mapstructure:"retryMinPause" yaml:"retryMinPause"`
+	RetryMaxPause               int64  `mapstructure:"retryMaxPause" yaml:"retryMaxPause"`
+	RequestTimeout              int64  `mapstructure:"requestTimeout" yaml:"requestTimeout"`
+	LLDPTTL                     int64  `mapstructure:"lldpTTL" yaml:"lldpTTL"`
+	LinkTTLMultiplier           int64  `mapstructure:"linkTTLMultiplier" yaml:"linkTTLMultiplier"`
+	LatencyMode                 string `mapstructure:"latencyMode" yaml:"latencyMode"`
+	LinkLossThreshold           int64  `mapstructure:"linkLossThreshold" yaml:"linkLossThreshold"`
+	LinkConfirmation            bool   `mapstructure:"linkConfirmation" yaml:"linkConfirmation"`
+	BDDP                        bool   `mapstructure:"bddp" yaml:"bddp"`
+	IPv6HostLearning            bool   `mapstructure:"ipv6HostLearning" yaml:"ipv6HostLearning"`
+	RouterSolicitationLearning  bool   `mapstructure:"routerSolicitationLearning" yaml:"routerSolicitationLearning"`
+	DHCPSnooping                bool   `mapstructure:"dhcpSnooping" yaml:"dhcpSnooping"`
+
+	// LLDP authentication policy and max clock skew; LLDPAuthKey is not exposed via gNMI, it can only be set via the
+	// config file
+	LLDPAuthPolicy  string `mapstructure:"lldpAuthPolicy" yaml:"lldpAuthPolicy"`
+	LLDPAuthMaxSkew int64  `mapstructure:"lldpAuthMaxSkew" yaml:"lldpAuthMaxSkew"`
+	LLDPAuthKey     string `mapstructure:"lldpAuthKey" yaml:"lldpAuthKey"`
+
+	// Link flap dampening parameters; 0 flap penalty disables dampening
+	FlapPenalty       int64 `mapstructure:"flapPenalty" yaml:"flapPenalty"`
+	SuppressThreshold int64 `mapstructure:"suppressThreshold" yaml:"suppressThreshold"`
+	ReuseThreshold    int64 `mapstructure:"reuseThreshold" yaml:"reuseThreshold"`
+	DampeningHalfLife int64 `mapstructure:"dampeningHalfLife" yaml:"dampeningHalfLife"`
+
+	// Host liveness probing parameters; 0 probe window disables probing, 0 probe rate disables its limit
+	HostProbeWindow   int64 `mapstructure:"hostProbeWindow" yaml:"hostProbeWindow"`
+	HostProbeInterval int64 `mapstructure:"hostProbeInterval" yaml:"hostProbeInterval"`
+	HostProbeRate     int64 `mapstructure:"hostProbeRate" yaml:"hostProbeRate"`
+
+	ExcludedPorts       []uint32 `mapstructure:"excludedPorts" yaml:"excludedPorts"`
+	ExcludedHosts       []string `mapstructure:"excludedHosts" yaml:"excludedHosts"`
+	ExcludedMACPrefixes []string `mapstructure:"excludedMACPrefixes" yaml:"excludedMACPrefixes"`
+	ExcludedIPPrefixes  []string `mapstructure:"excludedIPPrefixes" yaml:"excludedIPPrefixes"`
+
+	// LLDPVLANs lists the VLANs on which tagged LLDP packets are emitted, in addition to untagged ones, per port
+	LLDPVLANs []PortVLANs `mapstructure:"lldpVLANs" yaml:"lldpVLANs"`
+
+	// InterceptRules replace the built-in intercept rules, which are specific to the fabric-tna pipeline, if any are given
+	InterceptRules []InterceptRule `mapstructure:"interceptRules" yaml:"interceptRules"`
+
+	// LegacyLinkPaths publishes links keyed by ingress port only, retaining just the latest neighbor on each port
+	LegacyLinkPaths bool `mapstructure:"legacyLinkPaths" yaml:"legacyLinkPaths"`
+
+	// TargetTLS is not exposed via gNMI; it can only be set via the config file or the command-line options
+	TargetTLS TLSConfig `mapstructure:"targetTLS" yaml:"targetTLS"`
+}
+
+// PortVLANs holds the VLANs of a port, each given as its VLAN ID, or as outer and inner VLAN IDs separated by a dot
+type PortVLANs struct {
+	Port  uint32   `mapstructure:"port" yaml:"port"`
+	VLANs []string `mapstructure:"vlans" yaml:"vlans"`
 }
 
 type configWrapper struct {
@@ -34,9 +91,25 @@ func loadConfig() *Config {
 		Config: &Config{
 			EmitFrequency:               5,
 			MaxLinkAge:                  30,
+			MaxHostAge:                  30 * 60,
 			PipelineValidationFrequency: 60,
 			PortRediscoveryFrequency:    60,
 			LinkPruneFrequency:          2,
+			RetryMinPause:               1,
+			RetryMaxPause:               30,
+			RequestTimeout:              10,
+			LLDPTTL:                     30,
+			LinkTTLMultiplier:           1,
+			LatencyMode:                 latencyNone,
+			IPv6HostLearning:            false,
+			LLDPAuthPolicy:              lldpAuthNone,
+			LLDPAuthMaxSkew:             30,
+			FlapPenalty:                 1000,
+			SuppressThreshold:           2000,
+			ReuseThreshold:              750,
+			DampeningHalfLife:           60,
+			HostProbeInterval:           10,
+			HostProbeRate:               10,
 		},
 	}
 
@@ -51,9 +124,55 @@ func loadConfig() *Config {
 	if err := cfg.Unmarshal(wrapper); err != nil {
 		log.Warnf("Unable to parse config file; using defaults: %+v", err)
 	}
+	validateConfig(wrapper.Config)
 	return wrapper.Config
 }
 
+// Corrects any configuration values that would make the agent misbehave, returning the config tree leaves of the
+// corrected values, and the paths of those that have been dropped altogether
+func validateConfig(config *Config) ([]treeLeaf, []string) {
+	leaves := make([]treeLeaf, 0)
+	dropped := make([]string, 0)
+	if config.RetryMinPause < 1 {
+		log.Warnf("Invalid retryMinPause %d; using 1", config.RetryMinPause)
+		config.RetryMinPause = 1
+		leaves = append(leaves, treeLeaf{"config/retryMinPause", intVal(config.RetryMinPause)})
+	}
+	if config.RetryMaxPause < config.RetryMinPause {
+		log.Warnf("Invalid retryMaxPause %d; using %d", config.RetryMaxPause, config.RetryMinPause)
+		config.RetryMaxPause = config.RetryMinPause
+		leaves = append(leaves, treeLeaf{"config/retryMaxPause", intVal(config.RetryMaxPause)})
+	}
+	if config.DampeningHalfLife < 1 {
+		log.Warnf("Invalid dampeningHalfLife %d; using 1", config.DampeningHalfLife)
+		config.DampeningHalfLife = 1
+		leaves = append(leaves, treeLeaf{"config/dampeningHalfLife", intVal(config.DampeningHalfLife)})
+	}
+	// Reuse threshold must be below the suppress threshold, lest links be suppressed and released in the same pass
+	if config.ReuseThreshold >= config.SuppressThreshold {
+		log.Warnf("Invalid reuseThreshold %d, not below suppressThreshold %d; using %d",
+			config.ReuseThreshold, config.SuppressThreshold, config.SuppressThreshold/2)
+		config.ReuseThreshold = config.SuppressThreshold / 2
+		leaves = append(leaves, treeLeaf{"config/reuseThreshold", intVal(config.ReuseThreshold)})
+	}
+	// VLANs that cannot be parsed would only fail each time LLDP packets are emitted
+	ports := make([]PortVLANs, 0, len(config.LLDPVLANs))
+	for _, port := range config.LLDPVLANs {
+		vlans := validLLDPVLANs(port.Port, port.VLANs)
+		path := fmt.Sprintf("config/lldp-vlans[port=%d]", port.Port)
+		if len(vlans) == 0 {
+			dropped = append(dropped, path)
+			continue
+		}
+		if len(vlans) < len(port.VLANs) {
+			leaves = append(leaves, treeLeaf{path, stringVal(strings.Join(vlans, ","))})
+		}
+		ports = append(ports, PortVLANs{Port: port.Port, VLANs: vlans})
+	}
+	config.LLDPVLANs = ports
+	return leaves, dropped
+}
+
 func saveConfig(config *Config) {
 	cfg := viper.New()
 	cfg.Set("config", config)
@@ -71,12 +190,97 @@ func createConfigRoot(agentID string, config *Config) *configtree.Node {
 		&gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: config.EmitFrequency}})
 	root.AddPath("config/maxLinkAge",
 		&gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: config.MaxLinkAge}})
+	root.AddPath("config/maxHostAge",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: config.MaxHostAge}})
 	root.AddPath("config/pipelineValidationFrequency",
 		&gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: config.PipelineValidationFrequency}})
 	root.AddPath("config/portRediscoveryFrequency",
 		&gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: config.PortRediscoveryFrequency}})
 	root.AddPath("config/linkPruneFrequency",
 		&gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: config.LinkPruneFrequency}})
+	root.AddPath("config/retryMinPause",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: config.RetryMinPause}})
+	root.AddPath("config/retryMaxPause",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: config.RetryMaxPause}})
+	root.AddPath("config/requestTimeout",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: config.RequestTimeout}})
+	root.AddPath("config/lldpTTL",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: config.LLDPTTL}})
+	root.AddPath("config/linkTTLMultiplier",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: config.LinkTTLMultiplier}})
+	root.AddPath("config/linkLossThreshold",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: config.LinkLossThreshold}})
+	root.AddPath("config/linkConfirmation",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_BoolVal{BoolVal: config.LinkConfirmation}})
+	root.AddPath("config/bddp",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_BoolVal{BoolVal: config.BDDP}})
+	root.AddPath("config/ipv6HostLearning",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_BoolVal{BoolVal: config.IPv6HostLearning}})
+	root.AddPath("config/routerSolicitationLearning",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_BoolVal{BoolVal: config.RouterSolicitationLearning}})
+	root.AddPath("config/dhcpSnooping",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_BoolVal{BoolVal: config.DHCPSnooping}})
+	root.AddPath("config/latencyMode",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_StringVal{StringVal: config.LatencyMode}})
+	root.AddPath("config/lldpAuthPolicy",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_StringVal{StringVal: config.LLDPAuthPolicy}})
+	root.AddPath("config/lldpAuthMaxSkew",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: config.LLDPAuthMaxSkew}})
+	root.AddPath("config/flapPenalty",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: config.FlapPenalty}})
+	root.AddPath("config/suppressThreshold",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: config.SuppressThreshold}})
+	root.AddPath("config/reuseThreshold",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: config.ReuseThreshold}})
+	root.AddPath("config/dampeningHalfLife",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: config.DampeningHalfLife}})
+	root.AddPath("config/hostProbeWindow",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: config.HostProbeWindow}})
+	root.AddPath("config/hostProbeInterval",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: config.HostProbeInterval}})
+	root.AddPath("config/hostProbeRate",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: config.HostProbeRate}})
+	root.AddPath("config/legacyLinkPaths",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_BoolVal{BoolVal: config.LegacyLinkPaths}})
+	for _, port := range config.ExcludedPorts {
+		root.AddPath(fmt.Sprintf("config/exclude-port[number=%d]", port),
+			&gnmi.TypedValue{Value: &gnmi.TypedValue_BoolVal{BoolVal: true}})
+	}
+	for _, mac := range config.ExcludedHosts {
+		root.AddPath(fmt.Sprintf("config/exclude-host[mac=%s]", mac),
+			&gnmi.TypedValue{Value: &gnmi.TypedValue_BoolVal{BoolVal: true}})
+	}
+	for _, port := range config.LLDPVLANs {
+		root.AddPath(fmt.Sprintf("config/lldp-vlans[port=%d]", port.Port),
+			&gnmi.TypedValue{Value: &gnmi.TypedValue_StringVal{StringVal: strings.Join(port.VLANs, ",")}})
+	}
+	addInterceptRulesToRoot(root, config.InterceptRules)
+	root.AddPath("config/exclude-mac-prefixes",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_StringVal{StringVal: strings.Join(config.ExcludedMACPrefixes, ",")}})
+	root.AddPath("config/exclude-ip-prefixes",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_StringVal{StringVal: strings.Join(config.ExcludedIPPrefixes, ",")}})
+	for _, phase := range []string{connectPhase, pipelinePhase, arbitrationPhase} {
+		root.AddPath(fmt.Sprintf("state/connection/%s-retries", phase),
+			&gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: 0}})
+	}
+	for _, reason := range []string{lldpAuthMissing, lldpAuthInvalid, lldpAuthReplayed, lldpAuthReflected} {
+		root.AddPath(fmt.Sprintf("state/lldp-auth/%s", reason),
+			&gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: 0}})
+	}
+	for _, counter := range []string{"sent", "answered"} {
+		root.AddPath(fmt.Sprintf("state/host-probes/%s", counter),
+			&gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: 0}})
+	}
+	root.AddPath("state/controller/state",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_StringVal{StringVal: Disconnected.String()}})
+	root.AddPath("state/controller/last-transition-time",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_UintVal{UintVal: 0}})
+	root.AddPath("state/connection/status",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_StringVal{StringVal: "IDLE"}})
+	root.AddPath("state/connection/last-error",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_StringVal{StringVal: ""}})
+	root.AddPath("state/connection/last-error-time",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_UintVal{UintVal: 0}})
 	root.Add("state/links", nil, nil)
 	return root
 }
@@ -85,13 +289,100 @@ func createConfigRoot(agentID string, config *Config) *configtree.Node {
 // to reflect it back to the controller's Config structure for easy access.
 func (c *Controller) UpdateConfig() {
 	root := c.Root()
+	c.lock.Lock()
 	c.config.EmitFrequency = root.GetPath("config/emitFrequency").Value().GetIntVal()
 	c.config.MaxLinkAge = root.GetPath("config/maxLinkAge").Value().GetIntVal()
+	c.config.MaxHostAge = root.GetPath("config/maxHostAge").Value().GetIntVal()
 	c.config.PipelineValidationFrequency = root.GetPath("config/pipelineValidationFrequency").Value().GetIntVal()
 	c.config.PortRediscoveryFrequency = root.GetPath("config/portRediscoveryFrequency").Value().GetIntVal()
 	c.config.LinkPruneFrequency = root.GetPath("config/linkPruneFrequency").Value().GetIntVal()
+	c.config.RetryMinPause = root.GetPath("config/retryMinPause").Value().GetIntVal()
+	c.config.RetryMaxPause = root.GetPath("config/retryMaxPause").Value().GetIntVal()
+	c.config.RequestTimeout = root.GetPath("config/requestTimeout").Value().GetIntVal()
+	c.config.LLDPTTL = root.GetPath("config/lldpTTL").Value().GetIntVal()
+	c.config.LinkTTLMultiplier = root.GetPath("config/linkTTLMultiplier").Value().GetIntVal()
+	c.config.LinkLossThreshold = root.GetPath("config/linkLossThreshold").Value().GetIntVal()
+	c.config.LinkConfirmation = root.GetPath("config/linkConfirmation").Value().GetBoolVal()
+	c.config.BDDP = root.GetPath("config/bddp").Value().GetBoolVal()
+	c.config.IPv6HostLearning = root.GetPath("config/ipv6HostLearning").Value().GetBoolVal()
+	c.config.RouterSolicitationLearning = root.GetPath("config/routerSolicitationLearning").Value().GetBoolVal()
+	c.config.DHCPSnooping = root.GetPath("config/dhcpSnooping").Value().GetBoolVal()
+	c.config.LatencyMode = root.GetPath("config/latencyMode").Value().GetStringVal()
+	c.config.LLDPAuthPolicy = root.GetPath("config/lldpAuthPolicy").Value().GetStringVal()
+	c.config.LLDPAuthMaxSkew = root.GetPath("config/lldpAuthMaxSkew").Value().GetIntVal()
+	c.config.FlapPenalty = root.GetPath("config/flapPenalty").Value().GetIntVal()
+	c.config.SuppressThreshold = root.GetPath("config/suppressThreshold").Value().GetIntVal()
+	c.config.ReuseThreshold = root.GetPath("config/reuseThreshold").Value().GetIntVal()
+	c.config.DampeningHalfLife = root.GetPath("config/dampeningHalfLife").Value().GetIntVal()
+	c.config.HostProbeWindow = root.GetPath("config/hostProbeWindow").Value().GetIntVal()
+	c.config.HostProbeInterval = root.GetPath("config/hostProbeInterval").Value().GetIntVal()
+	c.config.HostProbeRate = root.GetPath("config/hostProbeRate").Value().GetIntVal()
+	c.config.ExcludedPorts = getExcludedPorts(root)
+	c.config.ExcludedHosts = getExcludedHosts(root)
+	c.config.ExcludedMACPrefixes = splitList(root.GetPath("config/exclude-mac-prefixes").Value().GetStringVal())
+	c.config.ExcludedIPPrefixes = splitList(root.GetPath("config/exclude-ip-prefixes").Value().GetStringVal())
+	c.config.LLDPVLANs = getLLDPVLANs(root)
+	c.config.InterceptRules = getInterceptRules(root)
+	leaves, dropped := validateConfig(c.config)
+	if len(leaves) > 0 {
+		c.updateTree(leaves...)
+	}
+	for _, path := range dropped {
+		c.deleteFromTree(path)
+	}
+	c.exclusions = newExclusions(c.config)
+	c.pruneExcluded()
+	if legacyLinkPaths := root.GetPath("config/legacyLinkPaths").Value().GetBoolVal(); legacyLinkPaths != c.config.LegacyLinkPaths {
+		c.switchLinkPaths(legacyLinkPaths)
+	}
+	c.lock.Unlock()
 	saveConfig(c.config)
-	c.setStateIf(Configured, Reconfigured)
+	c.setStateIf(Configured, Reconfigured, "configuration changed")
+
+	// Standby does not have a distinct reconfigured state; just wake it up to pick up the new configuration
+	if c.getState() == Standby {
+		c.notifyStateChanged()
+	}
+}
+
+// Returns the numbers of ports excluded via the config tree
+func getExcludedPorts(root *configtree.Node) []uint32 {
+	ports := make([]uint32, 0)
+	for _, node := range root.FindAll("config/exclude-port[number=...]") {
+		if !node.Value().GetBoolVal() {
+			continue
+		}
+		if port, err := strconv.ParseUint(node.Key()["number"], 10, 32); err == nil {
+			ports = append(ports, uint32(port))
+		}
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i] < ports[j] })
+	return ports
+}
+
+// Returns the MAC addresses of hosts excluded via the config tree
+func getExcludedHosts(root *configtree.Node) []string {
+	hosts := make([]string, 0)
+	for _, node := range root.FindAll("config/exclude-host[mac=...]") {
+		if node.Value().GetBoolVal() {
+			hosts = append(hosts, node.Key()["mac"])
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// Returns the VLANs of ports on which tagged LLDP packets are emitted, as configured via the config tree
+func getLLDPVLANs(root *configtree.Node) []PortVLANs {
+	ports := make([]PortVLANs, 0)
+	for _, node := range root.FindAll("config/lldp-vlans[port=...]") {
+		vlans := splitList(node.Value().GetStringVal())
+		if port, err := strconv.ParseUint(node.Key()["port"], 10, 32); err == nil && len(vlans) > 0 {
+			ports = append(ports, PortVLANs{Port: uint32(port), VLANs: vlans})
+		}
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Port < ports[j].Port })
+	return ports
 }
 
 // RefreshConfig refreshes the config tree state from any relevant external source state
@@ -99,36 +390,34 @@ func (c *Controller) RefreshConfig() {
 	// no-op here
 }
 
-func (c *Controller) addLinkToTree(ingressPort uint32, egressPort uint32, egressDeviceID string) {
-	portPath := fmt.Sprintf("state/link[port=%d]/egress-port", ingressPort)
-	portVal := &gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: int64(egressPort)}}
-	devicePath := fmt.Sprintf("state/link[port=%d]/egress-device", ingressPort)
-	deviceVal := &gnmi.TypedValue{Value: &gnmi.TypedValue_StringVal{StringVal: egressDeviceID}}
-	createTimePath := fmt.Sprintf("state/link[port=%d]/create-time", ingressPort)
-	createTimeVal := &gnmi.TypedValue{Value: &gnmi.TypedValue_UintVal{UintVal: uint64(time.Now().UnixNano())}}
+// Path and value of a config tree leaf
+type treeLeaf struct {
+	path  string
+	value *gnmi.TypedValue
+}
 
-	c.Root().AddPath(portPath, portVal)
-	c.Root().AddPath(devicePath, deviceVal)
-	c.Root().AddPath(createTimePath, createTimeVal)
+// Adds or updates the given leaves in the config tree and forwards the update notification to any subscribe responders;
+// must be called with lock held, as must any other changes of the config tree
+func (c *Controller) updateTree(leaves ...treeLeaf) {
+	updates := make([]*gnmi.Update, 0, len(leaves))
+	for _, leaf := range leaves {
+		c.Root().AddPath(leaf.path, leaf.value)
+		updates = append(updates, &gnmi.Update{Path: gnmiutils.ToPath(leaf.path), Val: leaf.value})
+	}
 
-	// Forward the add notification to any subscribe responders
 	c.SendToAllResponders(&gnmi.SubscribeResponse{Response: &gnmi.SubscribeResponse_Update{
 		Update: &gnmi.Notification{
 			Timestamp: time.Now().UnixNano(),
-			Update: []*gnmi.Update{
-				{Path: gnmiutils.ToPath(portPath), Val: portVal},
-				{Path: gnmiutils.ToPath(devicePath), Val: deviceVal},
-				{Path: gnmiutils.ToPath(createTimePath), Val: createTimeVal},
-			},
+			Update:    updates,
 		},
 	}})
 }
 
-func (c *Controller) removeLinkFromTree(ingressPort uint32) {
-	path := fmt.Sprintf("state/link[port=%d]", ingressPort)
+// Deletes the given path from the config tree and forwards the delete notification to any subscribe responders; must
+// be called with lock held
+func (c *Controller) deleteFromTree(path string) {
 	_ = c.Root().DeletePath(path)
 
-	// Forward the delete notification to any subscribe responders
 	c.SendToAllResponders(&gnmi.SubscribeResponse{Response: &gnmi.SubscribeResponse_Update{
 		Update: &gnmi.Notification{
 			Timestamp: time.Now().UnixNano(),
@@ -137,16 +426,127 @@ func (c *Controller) removeLinkFromTree(ingressPort uint32) {
 	}})
 }
 
-func (c *Controller) addHostToTree(macString string, ipString string, port uint32) {
-	portPath := fmt.Sprintf("state/host[mac=%s]/port", macString)
+// Produces integer typed value
+func intVal(v int64) *gnmi.TypedValue {
+	return &gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: v}}
+}
+
+// Produces string typed value
+func stringVal(v string) *gnmi.TypedValue {
+	return &gnmi.TypedValue{Value: &gnmi.TypedValue_StringVal{StringVal: v}}
+}
+
+// Produces boolean typed value
+func boolVal(v bool) *gnmi.TypedValue {
+	return &gnmi.TypedValue{Value: &gnmi.TypedValue_BoolVal{BoolVal: v}}
+}
+
+// Produces unsigned integer typed value
+func uintVal(v uint64) *gnmi.TypedValue {
+	return &gnmi.TypedValue{Value: &gnmi.TypedValue_UintVal{UintVal: v}}
+}
+
+// Produces floating point typed value
+func doubleVal(v float64) *gnmi.TypedValue {
+	return &gnmi.TypedValue{Value: &gnmi.TypedValue_DoubleVal{DoubleVal: v}}
+}
+
+// Returns the config tree path of the given link, which depends on whether legacy link paths are in use
+func (c *Controller) linkPath(key linkKey) string {
+	if c.config.LegacyLinkPaths {
+		return fmt.Sprintf("state/link[port=%d]", key.ingressPort)
+	}
+	if key.vlan != "" {
+		return fmt.Sprintf("state/link[port=%d,device=%s,egress-port=%s,vlan=%s]",
+			key.ingressPort, escapeKey(key.egressDeviceID), escapeKey(key.egressPortID), key.vlan)
+	}
+	return fmt.Sprintf("state/link[port=%d,device=%s,egress-port=%s]",
+		key.ingressPort, escapeKey(key.egressDeviceID), escapeKey(key.egressPortID))
+}
+
+// Returns the config tree path of the host with the given key; hosts on a VLAN are keyed by their VLAN as well
+func hostPath(key hostKey) string {
+	if key.vlan != "" {
+		return fmt.Sprintf("state/host[mac=%s,vlan=%s]", key.mac, key.vlan)
+	}
+	return fmt.Sprintf("state/host[mac=%s]", key.mac)
+}
+
+// Escapes characters that cannot be used in config tree path key values, e.g. in interface names used as port IDs
+var keyEscaper = strings.NewReplacer("%", "%25", "/", "%2F", ",", "%2C", "=", "%3D", "[", "%5B", "]", "%5D")
+
+// Returns the given value escaped for use in a config tree path key
+func escapeKey(value string) string {
+	return keyEscaper.Replace(value)
+}
+
+// Undoes the escaping by keyEscaper, e.g. for names of intercept rules read back from the config tree
+var keyUnescaper = strings.NewReplacer("%25", "%", "%2F", "/", "%2C", ",", "%3D", "=", "%5B", "[", "%5D", "]")
+
+// Returns the given config tree path key value unescaped
+func unescapeKey(value string) string {
+	return keyUnescaper.Replace(value)
+}
+
+func (c *Controller) addLinkToTree(link *Link) {
+	path := c.linkPath(link.key())
+	portIDPath := path + "/egress-port-id"
+	portIDVal := &gnmi.TypedValue{Value: &gnmi.TypedValue_StringVal{StringVal: link.EgressPortID}}
+	devicePath := path + "/egress-device"
+	deviceVal := &gnmi.TypedValue{Value: &gnmi.TypedValue_StringVal{StringVal: link.EgressDeviceID}}
+	createTimePath := path + "/create-time"
+	createTimeVal := &gnmi.TypedValue{Value: &gnmi.TypedValue_UintVal{UintVal: uint64(time.Now().UnixNano())}}
+
+	c.Root().AddPath(portIDPath, portIDVal)
+	c.Root().AddPath(devicePath, deviceVal)
+	c.Root().AddPath(createTimePath, createTimeVal)
+	updates := []*gnmi.Update{
+		{Path: gnmiutils.ToPath(portIDPath), Val: portIDVal},
+		{Path: gnmiutils.ToPath(devicePath), Val: deviceVal},
+		{Path: gnmiutils.ToPath(createTimePath), Val: createTimeVal},
+	}
+
+	// Numeric form of the egress port is published only if available
+	if link.EgressPort != 0 {
+		portPath := path + "/egress-port"
+		portVal := &gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: int64(link.EgressPort)}}
+		c.Root().AddPath(portPath, portVal)
+		updates = append(updates, &gnmi.Update{Path: gnmiutils.ToPath(portPath), Val: portVal})
+	}
+
+	// Forward the add notification to any subscribe responders
+	c.SendToAllResponders(&gnmi.SubscribeResponse{Response: &gnmi.SubscribeResponse_Update{
+		Update: &gnmi.Notification{
+			Timestamp: time.Now().UnixNano(),
+			Update:    updates,
+		},
+	}})
+
+	if link.Neighbor != nil {
+		c.updateTree(neighborLeaves(path, link.Neighbor)...)
+	}
+	if link.Authenticated != nil {
+		c.updateTree(treeLeaf{path + "/authenticated", boolVal(*link.Authenticated)})
+	}
+	if link.Bidirectional != nil {
+		c.updateTree(treeLeaf{path + "/bidirectional", boolVal(*link.Bidirectional)})
+	}
+	if link.Indirect != nil {
+		c.updateTree(treeLeaf{path + "/indirect", boolVal(*link.Indirect)})
+	}
+}
+
+func (c *Controller) removeLinkFromTree(key linkKey) {
+	c.deleteFromTree(c.linkPath(key))
+}
+
+func (c *Controller) addHostToTree(key hostKey, port uint32) {
+	portPath := hostPath(key) + "/port"
 	portVal := &gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: int64(port)}}
-	ipPath := fmt.Sprintf("state/host[mac=%s]/ip-address", macString)
-	ipVal := &gnmi.TypedValue{Value: &gnmi.TypedValue_StringVal{StringVal: ipString}}
-	createTimePath := fmt.Sprintf("state/host[mac=%s]/create-time", macString)
+	createTimePath := hostPath(key) + "/create-time"
 	createTimeVal := &gnmi.TypedValue{Value: &gnmi.TypedValue_UintVal{UintVal: uint64(time.Now().UnixNano())}}
 
 	c.Root().AddPath(portPath, portVal)
-	c.Root().AddPath(ipPath, ipVal)
 	c.Root().AddPath(createTimePath, createTimeVal)
 
 	// Forward the add notification to any subscribe responders
@@ -155,22 +555,45 @@ func (c *Controller) addHostToTree(macString string, ipString string, port uint3
 			Timestamp: time.Now().UnixNano(),
 			Update: []*gnmi.Update{
 				{Path: gnmiutils.ToPath(portPath), Val: portVal},
-				{Path: gnmiutils.ToPath(ipPath), Val: ipVal},
 				{Path: gnmiutils.ToPath(createTimePath), Val: createTimeVal},
 			},
 		},
 	}})
 }
 
-func (c *Controller) removeHostFromTree(macString string) {
-	path := fmt.Sprintf("state/host[mac=%s]", macString)
-	_ = c.Root().DeletePath(path)
+// Publishes the given IP address of the given host; ip-address leaf retains the most recently learned address for
+// the benefit of consumers that expect a single address
+func (c *Controller) addHostAddressToTree(key hostKey, ipString string) {
+	family := "ipv6"
+	if ip := net.ParseIP(ipString); ip != nil && ip.To4() != nil {
+		family = "ipv4"
+	}
+	path := fmt.Sprintf("%s/ip[address=%s]", hostPath(key), ipString)
+	c.updateTree(
+		treeLeaf{path + "/family", stringVal(family)},
+		treeLeaf{path + "/create-time", uintVal(uint64(time.Now().UnixNano()))},
+		treeLeaf{hostPath(key) + "/ip-address", stringVal(ipString)})
+}
 
-	// Forward the delete notification to any subscribe responders
-	c.SendToAllResponders(&gnmi.SubscribeResponse{Response: &gnmi.SubscribeResponse_Update{
-		Update: &gnmi.Notification{
-			Timestamp: time.Now().UnixNano(),
-			Delete:    []*gnmi.Path{gnmiutils.ToPath(path)},
-		},
-	}})
+// Removes the given IP address of the given host, whose remaining addresses have already been updated
+func (c *Controller) removeHostAddressFromTree(host *Host, ipString string) {
+	c.deleteFromTree(fmt.Sprintf("%s/ip[address=%s]", hostPath(host.key()), ipString))
+
+	// Make the ip-address leaf refer to the most recently updated address that remains
+	path := hostPath(host.key()) + "/ip-address"
+	if leaf := c.Root().GetPath(path); leaf != nil && leaf.Value().GetStringVal() == ipString {
+		latest := ""
+		for ip, lastUpdate := range host.addresses {
+			if latest == "" || lastUpdate.After(host.addresses[latest]) {
+				latest = ip
+			}
+		}
+		if latest != "" {
+			c.updateTree(treeLeaf{path, stringVal(latest)})
+		}
+	}
+}
+
+func (c *Controller) removeHostFromTree(key hostKey) {
+	c.deleteFromTree(hostPath(key))
 }
@@ -6,44 +6,113 @@ package discovery
 
 import (
 	"errors"
+	"github.com/openconfig/gnmi/proto/gnmi"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
-func getTestConfig() *Config {
-	configFile = "/tmp/config.yaml"
+// Points the config file to a fresh location private to the given test, restoring the original afterwards
+func useTestConfigFile(t *testing.T) {
+	original := configFile
+	configFile = filepath.Join(t.TempDir(), "config.yaml")
+	t.Cleanup(func() { configFile = original })
+}
+
+func getTestConfig(t *testing.T) *Config {
+	useTestConfigFile(t)
 	return loadConfig()
 }
 
 func Test_LoadDefaultConfig(t *testing.T) {
-	config := getTestConfig()
+	config := getTestConfig(t)
 	assert.Equal(t, int64(5), config.EmitFrequency)
 	assert.Equal(t, int64(2), config.LinkPruneFrequency)
+	assert.Equal(t, int64(30), config.MaxLinkAge)
+	assert.Equal(t, int64(1800), config.MaxHostAge)
+	assert.Equal(t, int64(30), config.LLDPTTL)
+	assert.Equal(t, int64(1), config.LinkTTLMultiplier)
+	assert.Equal(t, int64(1000), config.FlapPenalty)
+	assert.Equal(t, int64(2000), config.SuppressThreshold)
+	assert.Equal(t, int64(750), config.ReuseThreshold)
+	assert.Equal(t, int64(60), config.DampeningHalfLife)
+	assert.Equal(t, latencyNone, config.LatencyMode)
+	assert.Equal(t, int64(0), config.LinkLossThreshold)
+	assert.False(t, config.LinkConfirmation)
+	assert.False(t, config.BDDP)
+	assert.False(t, config.IPv6HostLearning)
+	assert.False(t, config.RouterSolicitationLearning)
+	assert.False(t, config.DHCPSnooping)
+	assert.Equal(t, int64(0), config.HostProbeWindow)
+	assert.Equal(t, int64(10), config.HostProbeInterval)
+	assert.Equal(t, int64(10), config.HostProbeRate)
+	assert.Empty(t, config.InterceptRules)
 }
 
 func Test_SaveAndLoadConfig(t *testing.T) {
-	config := getTestConfig()
+	config := getTestConfig(t)
 	assert.Equal(t, int64(5), config.EmitFrequency)
 
 	config.EmitFrequency = 7
+	config.LLDPVLANs = []PortVLANs{{Port: 1, VLANs: []string{"100", "0"}}, {Port: 2, VLANs: []string{"x"}}}
 	saveConfig(config)
-	defer os.Remove(configFile)
 
 	_, err := os.Stat(configFile)
 	assert.False(t, errors.Is(err, os.ErrNotExist))
 
-	config = getTestConfig()
+	// Invalid LLDP VLANs are dropped when loaded
+	config = loadConfig()
 	assert.Equal(t, int64(7), config.EmitFrequency)
+	assert.Equal(t, []PortVLANs{{Port: 1, VLANs: []string{"100"}}}, config.LLDPVLANs)
 }
 
 func TestController_UpdateConfig(t *testing.T) {
-	configFile = "/tmp/config.yaml"
-	defer os.Remove(configFile)
-	//controller := NewController("none", "123")
-
-	//controller.Root.AddPath("config/maxLinkAge",
-	//	&gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: 42}})
-	//controller.UpdateConfig()
-	//assert.Equal(t, int64(42), controller.config.MaxLinkAge)
+	useTestConfigFile(t)
+	controller := NewController("none", "123")
+
+	controller.Root().AddPath("config/maxLinkAge",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: 42}})
+	controller.Root().AddPath("config/maxHostAge",
+		&gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: 600}})
+	controller.UpdateConfig()
+	assert.Equal(t, int64(42), controller.config.MaxLinkAge)
+	assert.Equal(t, int64(600), controller.config.MaxHostAge)
+}
+
+func TestController_UpdateConfigValidation(t *testing.T) {
+	c, _ := newTestController(t)
+
+	// Retry pauses that would make the reconnect loop spin are corrected, and the corrections published
+	c.Root().AddPath("config/retryMinPause", intVal(0))
+	c.Root().AddPath("config/retryMaxPause", intVal(-5))
+	c.UpdateConfig()
+	assert.Equal(t, int64(1), c.config.RetryMinPause)
+	assert.Equal(t, int64(1), c.config.RetryMaxPause)
+	assert.Equal(t, int64(1), c.Root().GetPath("config/retryMinPause").Value().GetIntVal())
+	assert.Equal(t, int64(1), c.Root().GetPath("config/retryMaxPause").Value().GetIntVal())
+
+	c.Root().AddPath("config/retryMinPause", intVal(4))
+	c.Root().AddPath("config/retryMaxPause", intVal(2))
+	c.UpdateConfig()
+	assert.Equal(t, int64(4), c.config.RetryMinPause)
+	assert.Equal(t, int64(4), c.config.RetryMaxPause)
+
+	// Dampening that would never release links, or release them as soon as they are suppressed, is corrected too
+	c.Root().AddPath("config/dampeningHalfLife", intVal(0))
+	c.Root().AddPath("config/suppressThreshold", intVal(1000))
+	c.Root().AddPath("config/reuseThreshold", intVal(1000))
+	c.UpdateConfig()
+	assert.Equal(t, int64(1), c.config.DampeningHalfLife)
+	assert.Equal(t, int64(500), c.config.ReuseThreshold)
+	assert.Equal(t, int64(500), c.Root().GetPath("config/reuseThreshold").Value().GetIntVal())
+
+	// Invalid LLDP VLANs are dropped, along with ports left without any
+	c.Root().AddPath("config/lldp-vlans[port=1]", stringVal("100,0,5000,100.200.300,abc"))
+	c.Root().AddPath("config/lldp-vlans[port=2]", stringVal("4096"))
+	c.Root().AddPath("config/lldp-vlans[port=3]", stringVal("200.300"))
+	c.UpdateConfig()
+	assert.Equal(t, []PortVLANs{{Port: 1, VLANs: []string{"100"}}, {Port: 3, VLANs: []string{"200.300"}}}, c.config.LLDPVLANs)
+	assert.Equal(t, "100", c.Root().GetPath("config/lldp-vlans[port=1]").Value().GetStringVal())
+	assert.Nil(t, c.Root().GetPath("config/lldp-vlans[port=2]"))
 }
@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"encoding/binary"
+	"github.com/google/gopacket/layers"
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+const (
+	// Max number of links in the digest, limited by the max length of the TLV value, less the OUI, subtype and count
+	maxDigestLinks = (511 - 4 - 2) / 4
+
+	// Number of consecutive digests that must omit a link before it is considered unidirectional; this tolerates
+	// the neighbor emitting its packet before it heard from us for the first time
+	confirmationMisses = 2
+)
+
+// Returns true if links are to be confirmed by exchanging digests with the neighbors
+func (c *Controller) confirmsLinks() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.config.LinkConfirmation
+}
+
+// Returns the hash identifying the link whose egress is the given port of the given device within a digest
+func digestHash(deviceID string, portID string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(deviceID))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(portID))
+	return h.Sum32()
+}
+
+// Produces the digest TLV of the links heard on the given port, if links are confirmed; returns false otherwise
+func (c *Controller) newDigestTLV(portNumber uint32) (layers.LinkLayerDiscoveryValue, bool) {
+	if !c.confirmsLinks() {
+		return layers.LinkLayerDiscoveryValue{}, false
+	}
+	c.lock.RLock()
+	hashes := make([]uint32, 0)
+	for key := range c.links {
+		if key.ingressPort == portNumber {
+			hashes = append(hashes, digestHash(key.egressDeviceID, key.egressPortID))
+		}
+	}
+	c.lock.RUnlock()
+
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+	if len(hashes) > maxDigestLinks {
+		log.Warnf("Digest of port %d is limited to %d of its %d links", portNumber, maxDigestLinks, len(hashes))
+		hashes = hashes[:maxDigestLinks]
+	}
+	value := binary.BigEndian.AppendUint16(make([]byte, 0, 2+4*len(hashes)), uint16(len(hashes)))
+	for _, hash := range hashes {
+		value = binary.BigEndian.AppendUint32(value, hash)
+	}
+	return newOrgTLV(lldpDigestSubtype, value), true
+}
+
+// Returns true if the digest TLV of the given LLDP packet lists the link whose egress is the given port of this agent;
+// returns false as the second value if the packet carries no valid digest TLV
+func (c *Controller) isInDigest(info *layers.LinkLayerDiscoveryInfo, portNumber uint32) (bool, bool) {
+	digest := findOrgTLV(info, lldpDigestSubtype)
+	if len(digest) < 2 || len(digest) != 2+4*int(binary.BigEndian.Uint16(digest)) {
+		return false, false
+	}
+	hash := digestHash(c.IngressDeviceID, strconv.FormatUint(uint64(portNumber), 10))
+	for i := 2; i < len(digest); i += 4 {
+		if binary.BigEndian.Uint32(digest[i:]) == hash {
+			return true, true
+		}
+	}
+	return false, true
+}
+
+// Checks whether the neighbor of the given link heard from us, per the digest carried by the LLDP packet received
+// for the link, and updates whether the link is bidirectional accordingly
+func (c *Controller) updateLinkConfirmation(key linkKey, info *layers.LinkLayerDiscoveryInfo) {
+	if !c.confirmsLinks() {
+		return
+	}
+	confirmed, ok := c.isInDigest(info, key.ingressPort)
+	if !ok {
+		return
+	}
+
+	c.lock.Lock()
+	link, ok := c.links[key]
+	if !ok {
+		c.lock.Unlock()
+		return
+	}
+	if confirmed {
+		link.confirmationMisses = 0
+	} else if link.confirmationMisses++; link.confirmationMisses < confirmationMisses {
+		c.lock.Unlock()
+		return
+	}
+	c.lock.Unlock()
+	c.setLinkBidirectional(key, confirmed)
+}
+
+// Updates whether the given link is bidirectional, publishing the change
+func (c *Controller) setLinkBidirectional(key linkKey, bidirectional bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	link, ok := c.links[key]
+	if !ok || (link.Bidirectional != nil && *link.Bidirectional == bidirectional) {
+		return
+	}
+	link.Bidirectional = &bidirectional
+	if !bidirectional {
+		log.Warnf("Link is unidirectional, as the neighbor does not hear us: %d <- %s/%s", key.ingressPort, key.egressDeviceID, key.egressPortID)
+	}
+	if !c.isLinkSuppressed(key) {
+		c.updateTree(treeLeaf{c.linkPath(key) + "/bidirectional", boolVal(bidirectional)})
+	}
+}
@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestController_LinkConfirmation(t *testing.T) {
+	a, _ := newTestController(t)
+	a.IngressDeviceID = "foo"
+	a.config.LinkConfirmation = true
+	b, _ := newTestController(t)
+	b.IngressDeviceID = "bar"
+	b.config.LinkConfirmation = true
+
+	// Links are unconfirmed until the neighbor has heard from us
+	b.processLLDPPacket(1, newAgentLLDPPacket(t, a, 10, 30))
+	assert.Nil(t, b.GetLinks()[0].Bidirectional)
+
+	a.processLLDPPacket(10, newAgentLLDPPacket(t, b, 1, 30))
+	assert.True(t, *a.GetLinks()[0].Bidirectional)
+	assert.True(t, a.Root().GetPath("state/link[port=10,device=bar,egress-port=1]/bidirectional").Value().GetBoolVal())
+
+	b.processLLDPPacket(1, newAgentLLDPPacket(t, a, 10, 30))
+	assert.True(t, *b.GetLinks()[0].Bidirectional)
+
+	// Once we are no longer heard, the link should become unidirectional after consecutive misses
+	key := a.GetLinks()[0].key()
+	a.lock.Lock()
+	a.deleteLink(key)
+	a.lock.Unlock()
+	b.processLLDPPacket(1, newAgentLLDPPacket(t, a, 10, 30))
+	assert.True(t, *b.GetLinks()[0].Bidirectional)
+	b.processLLDPPacket(1, newAgentLLDPPacket(t, a, 10, 30))
+	assert.False(t, *b.GetLinks()[0].Bidirectional)
+	assert.False(t, b.Root().GetPath("state/link[port=1,device=foo,egress-port=10]/bidirectional").Value().GetBoolVal())
+
+	// Packets without digest should leave the link unconfirmed
+	a.config.LinkConfirmation = false
+	b.processLLDPPacket(2, newAgentLLDPPacket(t, a, 20, 30))
+	links := b.GetLinks()
+	assert.Len(t, links, 2)
+	assert.Nil(t, links[1].Bidirectional)
+	assert.Nil(t, b.Root().GetPath("state/link[port=2,device=foo,egress-port=20]/bidirectional"))
+}
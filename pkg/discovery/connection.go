@@ -7,16 +7,18 @@ package discovery
 import (
 	"context"
 	"encoding/binary"
+	"fmt"
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
+	"github.com/onosproject/onos-lib-go/pkg/errors"
 	"github.com/onosproject/onos-net-lib/pkg/p4utils"
-	"github.com/onosproject/onos-net-lib/pkg/packet"
 	"github.com/openconfig/gnmi/proto/gnmi"
 	p4api "github.com/p4lang/p4runtime/go/p4/v1"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
 	"io"
-	"strconv"
+	"sort"
 	"time"
 )
 
@@ -24,29 +26,43 @@ const (
 	linkAgentRoleName = "link_local_agent"
 	linkAgentRoleID   = "\x03"
 
-	connectionRetryPause            = 5 * time.Second
-	pipelineFetchRetryPause         = 5 * time.Second
 	mastershipArbitrationRetryPause = 5 * time.Second
+	maxStandbyPause                 = 2 * time.Minute
 )
 
 func (c *Controller) waitForDeviceConnection() {
 	log.Infof("Connecting to stratum agent at %s...", c.TargetAddress)
+	c.updateMastershipInTree(false)
+	c.closeConnection()
 	for c.getState() == Disconnected {
+		creds, err := c.transportCredentials(true)
+		if err != nil {
+			log.Warnf("Unable to load TLS credentials: %+v", err)
+			c.pauseIf(Disconnected, c.recordFailure(connectPhase, err))
+			continue
+		}
 		opts := []grpc.DialOption{
-			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithTransportCredentials(creds),
 			grpc.WithBlock(),
 		}
 
-		if conn, err := grpc.Dial(c.TargetAddress, opts...); err == nil {
+		ctx, ctxCancel := context.WithCancel(context.Background())
+		dialCtx, dialCancel := c.requestContext(ctx)
+		conn, err := grpc.DialContext(dialCtx, c.TargetAddress, opts...)
+		dialCancel()
+		if err == nil {
 			c.conn = conn
 			c.p4Client = p4api.NewP4RuntimeClient(c.conn)
 			c.gnmiClient = gnmi.NewGNMIClient(c.conn)
-			c.ctx, c.ctxCancel = context.WithCancel(context.Background())
-			c.setState(Connected)
+			c.ctx, c.ctxCancel = ctx, ctxCancel
+			c.recordSuccess(connectPhase)
+			go c.monitorConnectivity(ctx, conn)
+			c.setState(Connected, "connected to stratum agent")
 			log.Infof("Connected")
 		} else {
+			ctxCancel()
 			log.Warnf("Unable to connect to stratum agent: %+v", err)
-			c.pauseIf(Disconnected, connectionRetryPause)
+			c.pauseIf(Disconnected, c.recordFailure(connectPhase, err))
 		}
 	}
 }
@@ -55,37 +71,43 @@ func (c *Controller) waitForPipelineConfiguration() {
 	log.Infof("Retrieving pipeline configuration...")
 	for c.getState() == Connected {
 		// Ask for the pipeline config P4Infi and cookie
-		resp, err := c.p4Client.GetForwardingPipelineConfig(c.ctx, &p4api.GetForwardingPipelineConfigRequest{
+		ctx, cancel := c.requestContext(c.ctx)
+		resp, err := c.p4Client.GetForwardingPipelineConfig(ctx, &p4api.GetForwardingPipelineConfigRequest{
 			ResponseType: p4api.GetForwardingPipelineConfigRequest_P4INFO_AND_COOKIE,
 		})
+		cancel()
 		if err == nil {
 			if resp.Config.Cookie.Cookie != 0 {
 				c.cookie = resp.Config.Cookie.Cookie
 				c.info = resp.Config.P4Info
 				c.codec = p4utils.NewControllerMetadataCodec(c.info)
 				c.role = p4utils.NewStratumRole(linkAgentRoleName, c.codec.RoleAgentIDMetadataID(), []byte(linkAgentRoleID), true, false)
-				c.setState(PipelineConfigAvailable)
+				c.recordSuccess(pipelinePhase)
+				c.setState(PipelineConfigAvailable, "pipeline configuration obtained")
 				log.Infof("Pipeline configuration obtained and processed")
-			} else {
-				log.Warnf("Pipeline configuration not set yet on the stratum device")
+				return
 			}
+			log.Warnf("Pipeline configuration not set yet on the stratum device")
+			err = errors.NewUnavailable("pipeline configuration not set yet")
 		} else {
 			log.Warnf("Unable to retrieve pipeline configuration: %+v", err)
 		}
-		c.pauseIf(Connected, pipelineFetchRetryPause)
+		c.pauseIf(Connected, c.recordFailure(pipelinePhase, err))
 	}
 }
 
 func (c *Controller) validatePipelineConfiguration() {
 	log.Infof("Validating pipeline configuration...")
 	// Ask for the pipeline config cookie
-	resp, err := c.p4Client.GetForwardingPipelineConfig(c.ctx, &p4api.GetForwardingPipelineConfigRequest{
+	ctx, cancel := c.requestContext(c.ctx)
+	defer cancel()
+	resp, err := c.p4Client.GetForwardingPipelineConfig(ctx, &p4api.GetForwardingPipelineConfigRequest{
 		ResponseType: p4api.GetForwardingPipelineConfigRequest_COOKIE_ONLY,
 	})
 	if err == nil {
 		// If the cookie changed, transition back to connected state
 		if c.cookie != resp.Config.Cookie.Cookie {
-			c.setState(Connected)
+			c.setState(Connected, "pipeline configuration changed")
 			log.Infof("Pipeline configuration changed")
 		}
 		return
@@ -95,67 +117,226 @@ func (c *Controller) validatePipelineConfiguration() {
 
 func (c *Controller) waitForMastershipArbitration() {
 	log.Infof("Running mastership arbitration...")
-	var err error
 	for c.getState() == PipelineConfigAvailable {
 		// Establish stream channel
-		if c.stream, err = c.p4Client.StreamChannel(c.ctx); err == nil {
+		c.closeStream()
+		ctx, ctxCancel := context.WithCancel(c.ctx)
+		stream, err := c.p4Client.StreamChannel(ctx)
+		if err == nil {
+			// Bid with a low election ID first, so that we join as a backup if another agent is already the primary
+			electionID := backupElectionID()
 			for c.getState() == PipelineConfigAvailable {
 				// Issue mastership arbitration request
-				c.electionID = p4utils.TimeBasedElectionID()
-				if err = c.stream.Send(p4utils.CreateMastershipArbitration(c.electionID, c.role)); err == nil {
-					var mar *p4api.MasterArbitrationUpdate
-					for c.getState() == PipelineConfigAvailable && mar == nil {
-						// Wait for mastership arbitration update
-						var msg *p4api.StreamMessageResponse
-						if msg, err = c.stream.Recv(); err != nil {
-							log.Warnf("Unable to receive stream response: %+v", err)
-							if err == io.EOF {
-								c.setState(Disconnected)
-							}
-						} else {
-							mar = msg.GetArbitration()
-							if mar == nil {
-								log.Warnf("Did not receive mastership arbitration: %+v", msg)
-							}
+				if err = stream.Send(p4utils.CreateMastershipArbitration(electionID, c.role)); err != nil {
+					break
+				}
+				// Give up on the stream if we don't get mastership arbitration update in time
+				timer := time.AfterFunc(c.requestTimeout(), ctxCancel)
+				var mar *p4api.MasterArbitrationUpdate
+				for c.getState() == PipelineConfigAvailable && mar == nil {
+					// Wait for mastership arbitration update
+					var msg *p4api.StreamMessageResponse
+					if msg, err = stream.Recv(); err != nil {
+						log.Warnf("Unable to receive stream response: %+v", err)
+						if err == io.EOF {
+							c.setState(Disconnected, "stream closed by stratum agent")
 						}
+						break
 					}
-
-					// If we got mastership arbitration with a winning election ID matching ours, return
-					if mar != nil && mar.ElectionId != nil &&
-						mar.ElectionId.High == c.electionID.High && mar.ElectionId.Low == c.electionID.Low {
-						c.setState(Elected)
-						log.Infof("Obtained mastership for role: %s", linkAgentRoleName)
-						return
+					if mar = msg.GetArbitration(); mar == nil {
+						log.Warnf("Did not receive mastership arbitration: %+v", msg)
 					}
 				}
+				if !timer.Stop() {
+					err = errors.NewTimeout("mastership arbitration update not received in time")
+					break
+				}
+				if mar == nil {
+					break
+				}
+
+				switch {
+				case sameElectionID(mar.ElectionId, electionID) && arbitrationStatus(mar) == codes.OK && isBackupElectionID(electionID):
+					// If we won with the backup ID, as there is no primary, bid again at once with a time-based ID;
+					// otherwise, any agent started later would win over us with its own, higher, backup ID
+					electionID = p4utils.TimeBasedElectionID()
+				case sameElectionID(mar.ElectionId, electionID) && arbitrationStatus(mar) == codes.OK:
+					// If we got mastership arbitration with a winning election ID matching ours, start handling the stream
+					c.startStream(stream, ctxCancel, electionID, Elected)
+					log.Infof("Obtained mastership for role: %s", linkAgentRoleName)
+					return
+				case arbitrationStatus(mar) == codes.NotFound:
+					// If there is no primary, bid again with an election ID higher than any backup ID
+					electionID = p4utils.TimeBasedElectionID()
+				default:
+					// Otherwise, another agent is the primary, so we stand by as a backup
+					c.startStream(stream, ctxCancel, electionID, Standby)
+					log.Infof("Standing by as backup for role: %s", linkAgentRoleName)
+					return
+				}
 			}
 		}
-		c.pauseIf(PipelineConfigAvailable, mastershipArbitrationRetryPause)
+		ctxCancel()
+		if c.getState() == PipelineConfigAvailable {
+			log.Warnf("Unable to establish mastership arbitration: %+v", err)
+			c.pauseIf(PipelineConfigAvailable, c.recordFailure(arbitrationPhase, err))
+		}
+	}
+}
+
+// Adopts the given stream and election ID, transitions to the given state and starts processing the stream messages
+func (c *Controller) startStream(stream p4api.P4Runtime_StreamChannelClient, streamCancel context.CancelFunc,
+	electionID *p4api.Uint128, state State) {
+	c.lock.Lock()
+	c.stream = stream
+	c.streamCancel = streamCancel
+	c.electionID = electionID
+	if state == Elected {
+		c.electedAt = c.now()
+	}
+	if state == Elected {
+		c.changeState(state, "obtained mastership")
+	} else {
+		c.changeState(state, "another agent is the primary")
+	}
+	c.lock.Unlock()
+
+	c.recordSuccess(arbitrationPhase)
+	c.updateMastershipInTree(state != Standby)
+	go c.handlePackets(stream)
+}
+
+// Closes the current stream channel, if any
+func (c *Controller) closeStream() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.streamCancel != nil {
+		c.streamCancel()
+		c.streamCancel = nil
 	}
 }
 
-func (c *Controller) handlePackets() {
+// Returns a low election ID, which is lower than any time-based election ID, yet distinct from those of other agents
+func backupElectionID() *p4api.Uint128 {
+	return &p4api.Uint128{High: 0, Low: uint64(time.Now().UnixNano())}
+}
+
+// Returns true if the given election ID is a backup election ID
+func isBackupElectionID(id *p4api.Uint128) bool {
+	return id != nil && id.High == 0
+}
+
+// Bids again with a time-based election ID if we hold mastership with a backup election ID, so that agents started
+// later do not win over us with their own backup election IDs; must be called with lock held
+func (c *Controller) rebidIfBackupElectionID() {
+	if !isBackupElectionID(c.electionID) || c.stream == nil {
+		return
+	}
+	c.electionID = p4utils.TimeBasedElectionID()
+	if err := c.stream.Send(p4utils.CreateMastershipArbitration(c.electionID, c.role)); err != nil {
+		log.Warnf("Unable to send mastership arbitration: %+v", err)
+	}
+}
+
+// Returns true if the two election IDs are the same
+func sameElectionID(a *p4api.Uint128, b *p4api.Uint128) bool {
+	return a != nil && b != nil && a.High == b.High && a.Low == b.Low
+}
+
+// Returns the status code of the given arbitration update; missing status is treated as OK
+func arbitrationStatus(mar *p4api.MasterArbitrationUpdate) codes.Code {
+	if mar.Status == nil {
+		return codes.OK
+	}
+	return codes.Code(mar.Status.Code)
+}
+
+func (c *Controller) handlePackets(stream p4api.P4Runtime_StreamChannelClient) {
 	log.Infof("Monitoring message stream")
 	for {
-		msg, err := c.stream.Recv()
+		msg, err := stream.Recv()
 		if err != nil {
 			log.Warnf("Unable to read stream response: %+v", err)
 			if err == io.EOF {
-				c.setState(Disconnected)
+				c.setState(Disconnected, "stream closed by stratum agent")
+			} else if c.getState() == Standby {
+				// If we lost the stream while standing by, re-establish it after a backoff period
+				c.pauseIf(Standby, standbyPause(c.demotions))
+				c.setStateIf(Standby, PipelineConfigAvailable, fmt.Sprintf("stream failed: %v", err))
+			} else {
+				// If we lost the current stream while we're the primary, re-establish it
+				c.lock.Lock()
+				if c.stream == stream && (c.state == Elected || c.state == PortsDiscovered || c.state == Configured || c.state == Reconfigured) {
+					c.changeState(PipelineConfigAvailable, fmt.Sprintf("stream failed: %v", err))
+				}
+				c.lock.Unlock()
 			}
 			return
 		}
 
-		if msg.GetPacket() != nil {
+		if msg.GetPacket() != nil && c.getState() != Standby {
 			c.processPacket(msg.GetPacket())
 		}
-		// TODO: deal with mastership arbitration update in case we got demoted
+		if msg.GetArbitration() != nil {
+			c.processArbitrationUpdate(msg.GetArbitration())
+		}
+
+		switch c.getState() {
+		case Disconnected, Connected, PipelineConfigAvailable, Stopped:
+			return
+		}
+	}
+}
+
+// Processes the given arbitration update, transitioning to standby state if it indicates that we got demoted,
+// or re-entering discovery if it indicates that we got promoted
+func (c *Controller) processArbitrationUpdate(mar *p4api.MasterArbitrationUpdate) {
+	c.lock.Lock()
+	ours := sameElectionID(mar.ElectionId, c.electionID)
+	status := arbitrationStatus(mar)
+	switch {
+	case ours && status == codes.OK:
+		if c.state == Standby {
+			log.Infof("Obtained mastership for role: %s", linkAgentRoleName)
+			c.electedAt = c.now()
+			c.changeState(Elected, "promoted to primary")
+			c.rebidIfBackupElectionID()
+			c.lock.Unlock()
+			c.updateMastershipInTree(true)
+			return
+		}
 
-		state := c.getState()
-		if state != Configured && state != Reconfigured {
+	case status == codes.NotFound:
+		// If the primary went away, bid for mastership using an election ID higher than that of any backups
+		if c.state == Standby && c.stream != nil {
+			log.Infof("No primary for role %s; bidding for mastership", linkAgentRoleName)
+			c.electionID = p4utils.TimeBasedElectionID()
+			if err := c.stream.Send(p4utils.CreateMastershipArbitration(c.electionID, c.role)); err != nil {
+				log.Warnf("Unable to send mastership arbitration: %+v", err)
+			}
+		}
+
+	default:
+		if c.state == Elected || c.state == PortsDiscovered || c.state == Configured || c.state == Reconfigured {
+			log.Warnf("Lost mastership for role %s: %+v", linkAgentRoleName, mar)
+			// Start the backoff anew if we held on to mastership long enough
+			if c.now().Sub(c.electedAt) > maxStandbyPause {
+				c.demotions = 0
+			}
+			c.demotions++
+			c.changeState(Standby, "demoted by another agent")
+			c.lock.Unlock()
+			c.updateMastershipInTree(false)
 			return
 		}
 	}
+	c.lock.Unlock()
+}
+
+// Returns the pause before re-establishing the stream after the given number of consecutive demotions; doubles with
+// each, up to a limit
+func standbyPause(demotions int) time.Duration {
+	return exponentialPause(mastershipArbitrationRetryPause, maxStandbyPause, demotions)
 }
 
 func (c *Controller) processPacket(packetIn *p4api.PacketIn) {
@@ -163,107 +344,372 @@ func (c *Controller) processPacket(packetIn *p4api.PacketIn) {
 	lldpLayer := rawPacket.Layer(layers.LayerTypeLinkLayerDiscovery)
 	if lldpLayer != nil {
 		pim := c.codec.DecodePacketInMetadata(packetIn.Metadata)
-		lldp := lldpLayer.(*layers.LinkLayerDiscovery)
-		egressPort, err := strconv.ParseUint(string(lldp.PortID.ID), 10, 32)
-		if err != nil {
-			log.Warn("Unable to parse egress port ID: %+v", err)
-			return
-		}
-		c.updateIngressLink(pim.IngressPort, uint32(egressPort), string(lldp.ChassisID.ID))
+		c.processLLDPPacket(pim.IngressPort, rawPacket)
+	}
+
+	// BDDP carries LLDP payload, which is not decoded on its own due to the ethernet type
+	if ethType, payload := innerEthernetType(rawPacket); ethType == ethernetTypeBDDP {
+		pim := c.codec.DecodePacketInMetadata(packetIn.Metadata)
+		c.processBDDPPacket(pim.IngressPort, packetVLAN(rawPacket), payload)
 	}
 
 	// if condition to process ARP packet
 	arpLayer := rawPacket.Layer(layers.LayerTypeARP)
 	if arpLayer != nil {
 		pim := c.codec.DecodePacketInMetadata(packetIn.Metadata)
-		arp := arpLayer.(*layers.ARP)
-		c.updateHost(packet.MACString(arp.SourceHwAddress), packet.IPString(arp.SourceProtAddress), pim.IngressPort)
+		c.processARPPacket(pim.IngressPort, packetVLAN(rawPacket), arpLayer.(*layers.ARP))
+	}
+
+	// Hosts are learned by snooping on DHCP as well
+	if rawPacket.Layer(layers.LayerTypeDHCPv4) != nil {
+		pim := c.codec.DecodePacketInMetadata(packetIn.Metadata)
+		c.processDHCPPacket(pim.IngressPort, rawPacket)
+	}
+
+	// IPv6 hosts are learned from neighbor discovery messages
+	if rawPacket.Layer(layers.LayerTypeICMPv6) != nil {
+		pim := c.codec.DecodePacketInMetadata(packetIn.Metadata)
+		c.processNDPPacket(pim.IngressPort, rawPacket)
 	}
 }
 
-func (c *Controller) programPacketInterceptRules() {
+// Identifiers of the P4 entities of the rules that punt packets to the CPU
+type puntRuleIDs struct {
+	tableID       uint32
+	punt          *aclActionIDs
+	copy          *aclActionIDs     // nil if the pipeline does not support copying packets to the CPU
+	matchFieldIDs map[string]uint32 // by match field name
+}
+
+// Identifiers of an ACL action that sends packets to the CPU and of its role agent ID param
+type aclActionIDs struct {
+	actionID            uint32
+	setRoleAgentParamID uint32
+}
+
+// Resolves the identifiers of the P4 entities of the punt rules; returns false if any of the required ones cannot be
+// found
+func (c *Controller) findPuntRuleIDs() (*puntRuleIDs, bool) {
+	if c.info == nil {
+		return nil, false
+	}
 	aclTable := p4utils.FindTable(c.info, "FabricIngress.acl.acl")
-	puntAction := p4utils.FindAction(c.info, "FabricIngress.acl.punt_to_cpu")
+	puntAction := c.findACLAction("FabricIngress.acl.punt_to_cpu")
 
-	if aclTable == nil {
-		log.Warnf("Unable to find FabricIngress.acl.acl table or FabricIngress.acl.punt_to_cpu action")
-		return
+	if aclTable == nil || puntAction == nil {
+		log.Warnf("Unable to find FabricIngress.acl.acl table or FabricIngress.acl.punt_to_cpu action with set_role_agent_id param")
+		return nil, false
 	}
 
-	ethTypeMatchField := p4utils.FindTableMatchField(aclTable, "eth_type")
-	if ethTypeMatchField == nil {
+	if p4utils.FindTableMatchField(aclTable, "eth_type") == nil {
 		log.Warnf("Unable to find eth_type match field")
+		return nil, false
+	}
+
+	ids := &puntRuleIDs{
+		tableID:       aclTable.Preamble.Id,
+		punt:          puntAction,
+		copy:          c.findACLAction("FabricIngress.acl.copy_to_cpu"),
+		matchFieldIDs: make(map[string]uint32),
+	}
+	for _, field := range aclTable.MatchFields {
+		ids.matchFieldIDs[field.Name] = field.Id
+	}
+	return ids, true
+}
+
+// Resolves the identifiers of the given ACL action and of its role agent ID param; nil if either cannot be found
+func (c *Controller) findACLAction(name string) *aclActionIDs {
+	action := p4utils.FindAction(c.info, name)
+	if action == nil {
+		return nil
+	}
+	param := p4utils.FindActionParam(action, "set_role_agent_id")
+	if param == nil {
+		return nil
+	}
+	return &aclActionIDs{actionID: action.Preamble.Id, setRoleAgentParamID: param.Id}
+}
+
+// Builder of the matches of a punt rule
+type puntMatchBuilder struct {
+	ids     *puntRuleIDs
+	matches []*p4api.FieldMatch
+	err     error
+}
+
+// Starts building the matches of a punt rule
+func (ids *puntRuleIDs) newMatch() *puntMatchBuilder {
+	return &puntMatchBuilder{ids: ids}
+}
+
+// Adds ternary match of the given field on the given value, with all bits significant
+func (b *puntMatchBuilder) field(name string, value []byte) *puntMatchBuilder {
+	fieldID, ok := b.ids.matchFieldIDs[name]
+	if !ok {
+		if b.err == nil {
+			b.err = errors.NewNotFound("match field %s not found", name)
+		}
+		return b
+	}
+	mask := make([]byte, len(value))
+	for i := range mask {
+		mask[i] = 0xff
 	}
+	b.matches = append(b.matches, &p4api.FieldMatch{
+		FieldId: fieldID,
+		FieldMatchType: &p4api.FieldMatch_Ternary_{
+			Ternary: &p4api.FieldMatch_Ternary{Value: value, Mask: mask},
+		},
+	})
+	return b
+}
+
+// Adds match of the given ethernet type
+func (b *puntMatchBuilder) ethType(ethType layers.EthernetType) *puntMatchBuilder {
+	return b.field("eth_type", binary.BigEndian.AppendUint16(nil, uint16(ethType)))
+}
+
+// Adds match of the given IP protocol
+func (b *puntMatchBuilder) ipProto(proto layers.IPProtocol) *puntMatchBuilder {
+	return b.field("ip_proto", []byte{byte(proto)})
+}
+
+// Adds match of the given ICMP type
+func (b *puntMatchBuilder) icmpType(icmpType uint8) *puntMatchBuilder {
+	return b.field("icmp_type", []byte{icmpType})
+}
+
+// Adds match of the given L4 destination port
+func (b *puntMatchBuilder) l4DstPort(port uint16) *puntMatchBuilder {
+	return b.field("l4_dport", binary.BigEndian.AppendUint16(nil, port))
+}
+
+// Returns the built matches; returns error if any of the match fields is not supported by the pipeline
+func (b *puntMatchBuilder) build() ([]*p4api.FieldMatch, error) {
+	return b.matches, b.err
+}
 
-	setAgentRoleActionParam := p4utils.FindActionParam(puntAction, "set_role_agent_id")
-	if aclTable == nil {
-		log.Warnf("Unable to find set_role_agent_id action param")
+// Programs the intercept rules afresh, e.g. after the connection to the switch has been (re-)established
+func (c *Controller) programPacketInterceptRules() {
+	c.programmedIntercepts = make(map[string]*p4api.TableEntry)
+	c.syncInterceptRules()
+}
+
+// Reconciles the intercept rules installed on the switch with the required ones, i.e. the declared rules if any, or
+// else the built-in rules of the enabled features; entries of rules no longer required are deleted, and entries of
+// changed rules are modified, or replaced if their match has changed
+func (c *Controller) syncInterceptRules() {
+	if c.info == nil {
 		return
 	}
+	required := c.requiredInterceptRules()
+
+	// Stale entries are deleted first, so that changed rules can take their place
+	for name, entry := range c.programmedIntercepts {
+		want, ok := required[name]
+		if want != nil && sameMatchKey(entry, want) {
+			continue
+		}
+		if err := c.writeTableEntry(p4api.Update_DELETE, entry); err != nil {
+			log.Warnf("Unable to delete %s intercept rule: %+v", name, err)
+			continue
+		}
+		delete(c.programmedIntercepts, name)
+		if !ok {
+			c.deleteInterceptRuleStatus(name)
+		}
+	}
+
+	names := make([]string, 0, len(required))
+	for name, want := range required {
+		if want != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		want := required[name]
+		updateType := p4api.Update_INSERT
+		if entry, ok := c.programmedIntercepts[name]; ok {
+			// Entry whose match has changed, but which could not be deleted, is left as is until the next attempt
+			if proto.Equal(entry, want) || !sameMatchKey(entry, want) {
+				continue
+			}
+			updateType = p4api.Update_MODIFY
+		}
+		if err := c.writeTableEntry(updateType, want); err != nil {
+			log.Warnf("Unable to install %s intercept rule: %+v", name, err)
+			c.updateInterceptRuleStatus(name, interceptFailed, err)
+			continue
+		}
+		c.programmedIntercepts[name] = want
+		c.updateInterceptRuleStatus(name, interceptInstalled, nil)
+	}
+}
+
+// Returns the table entries of the required intercept rules by name; rules that do not resolve are reported as
+// invalid, and are given without an entry
+func (c *Controller) requiredInterceptRules() map[string]*p4api.TableEntry {
+	required := make(map[string]*p4api.TableEntry)
+
+	// Declared rules take the place of the built-in ones, e.g. for pipelines other than fabric-tna
+	if rules := c.interceptRules(); len(rules) > 0 {
+		for i := range rules {
+			entry, err := resolveInterceptRule(c.info, &rules[i])
+			if err != nil {
+				log.Warnf("Unable to resolve %s intercept rule: %+v", rules[i].Name, err)
+				c.updateInterceptRuleStatus(rules[i].Name, interceptInvalid, err)
+			}
+			required[rules[i].Name] = entry
+		}
+		return required
+	}
+
+	ids, ok := c.findPuntRuleIDs()
+	if !ok {
+		return required
+	}
 
-	// installing punt rule for LLDP
-	if err := c.installPuntRule(aclTable.Preamble.Id, puntAction.Preamble.Id, ethTypeMatchField.Id, setAgentRoleActionParam.Id, layers.EthernetTypeLinkLayerDiscovery); err != nil {
-		log.Warnf("Unable to install LLDP intercept rule: %+v", err)
+	// punt rules for LLDP and ARP
+	c.addInterceptRule(required, ids, "LLDP", false, ids.newMatch().ethType(layers.EthernetTypeLinkLayerDiscovery))
+	c.addInterceptRule(required, ids, "ARP", false, ids.newMatch().ethType(layers.EthernetTypeARP))
+
+	// punt rules for any enabled optional features
+	if c.emitsBDDP() {
+		c.addInterceptRule(required, ids, "BDDP", false, ids.newMatch().ethType(ethernetTypeBDDP))
+	}
+
+	// NDP and DHCP packets must still reach their destination, so they are copied rather than punted
+	if c.learnsIPv6Hosts() {
+		for _, icmpType := range c.ndpICMPTypes() {
+			c.addInterceptRule(required, ids, fmt.Sprintf("ICMPv6 type %d", icmpType), true, ids.newMatch().
+				ethType(layers.EthernetTypeIPv6).ipProto(layers.IPProtocolICMPv6).icmpType(icmpType))
+		}
+	}
+	if c.snoopsDHCP() {
+		for _, port := range []uint16{dhcpServerPort, dhcpClientPort} {
+			c.addInterceptRule(required, ids, fmt.Sprintf("DHCP port %d", port), true, ids.newMatch().
+				ethType(layers.EthernetTypeIPv4).ipProto(layers.IPProtocolUDP).l4DstPort(port))
+		}
 	}
+	return required
+}
 
-	// installing punt rule for ARP
-	if err := c.installPuntRule(aclTable.Preamble.Id, puntAction.Preamble.Id, ethTypeMatchField.Id, setAgentRoleActionParam.Id, layers.EthernetTypeARP); err != nil {
-		log.Warnf("Unable to install ARP intercept rule: %+v", err)
+// Adds to the given required rules the built-in rule with the given matches that punts, or copies, the named packets
+// to the CPU
+func (c *Controller) addInterceptRule(required map[string]*p4api.TableEntry, ids *puntRuleIDs, name string, copyToCPU bool, match *puntMatchBuilder) {
+	action := ids.punt
+	if copyToCPU {
+		if action = ids.copy; action == nil {
+			log.Warnf("Unable to install %s intercept rule: FabricIngress.acl.copy_to_cpu action not found", name)
+			return
+		}
+	}
+	matches, err := match.build()
+	if err != nil {
+		log.Warnf("Unable to resolve %s intercept rule: %+v", name, err)
+		c.updateInterceptRuleStatus(name, interceptInvalid, err)
+		required[name] = nil
+		return
 	}
+	required[name] = puntEntry(ids.tableID, action, matches...)
 }
 
 func (c *Controller) emitLLDPPackets() {
 	log.Infof("Sending LLDP packets...")
+	ttl, sequence, bddp := c.lldpTTL(), c.nextProbeSequence(), c.emitsBDDP()
 	for _, port := range c.ports {
-		lldpBytes, err := packet.ControllerLLDPPacket(c.IngressDeviceID, port.Number)
-		if err != nil {
-			log.Warnf("Unable to create LLDP packet: %+v", err)
-		} else {
-			err = c.stream.Send(&p4api.StreamMessageRequest{
-				Update: &p4api.StreamMessageRequest_Packet{
-					Packet: &p4api.PacketOut{
-						Payload:  lldpBytes,
-						Metadata: c.codec.EncodePacketOutMetadata(&p4utils.PacketOutMetadata{EgressPort: port.Number}),
-					}},
-			})
+		if c.getState() == Standby {
+			log.Infof("Not sending LLDP packets while in standby")
+			return
+		}
+		if c.isPortExcluded(port.Number) {
+			continue
+		}
+		// Untagged packets are emitted first, followed by tagged copies for each VLAN configured for the port; each
+		// copy is produced anew, so that it carries its own authentication timestamp
+		for _, vlan := range append([]string{""}, c.lldpVLANs(port.Number)...) {
+			lldpBytes, err := c.lldpPacket(port.Number, ttl, sequence)
 			if err != nil {
-				log.Warnf("Unable to emit LLDP packet-out: %+v", err)
+				log.Warnf("Unable to create LLDP packet: %+v", err)
+				continue
 			}
+
+			// BDDP is emitted after LLDP, so that it does not appear to replay the LLDP of a direct link
+			var bddpBytes []byte
+			if bddp {
+				if bddpBytes, err = c.bddpPacket(port.Number, ttl, sequence); err != nil {
+					log.Warnf("Unable to create BDDP packet: %+v", err)
+				}
+			}
+			c.emitDiscoveryPackets(port.Number, vlan, lldpBytes, bddpBytes)
 		}
 	}
 	log.Info("LLDP packets emitted")
 }
 
-func (c *Controller) installPuntRule(tableID uint32, actionID uint32, ethTypeMatchFieldID uint32, setRoleAgentParamID uint32, ethType layers.EthernetType) error {
-	ethTypeValue := []byte{0, 0}
-	binary.BigEndian.PutUint16(ethTypeValue, uint16(ethType))
-	_, err := c.p4Client.Write(c.ctx, &p4api.WriteRequest{
+// Emits the given LLDP and, if any, BDDP packets on the given port, tagged with the given VLAN, if any
+func (c *Controller) emitDiscoveryPackets(portNumber uint32, vlan string, lldpBytes []byte, bddpBytes []byte) {
+	vlanIDs, err := parseVLAN(vlan)
+	if err != nil {
+		log.Warnf("Unable to emit LLDP packet-out on port %d: %+v", portNumber, err)
+		return
+	}
+	if err = c.emitPacket(portNumber, tagPacket(lldpBytes, vlanIDs)); err != nil {
+		log.Warnf("Unable to emit LLDP packet-out: %+v", err)
+	}
+	if bddpBytes != nil {
+		if err = c.emitPacket(portNumber, tagPacket(bddpBytes, vlanIDs)); err != nil {
+			log.Warnf("Unable to emit BDDP packet-out: %+v", err)
+		}
+	}
+}
+
+// Emits the given packet via the given port
+func (c *Controller) emitPacket(portNumber uint32, payload []byte) error {
+	return c.stream.Send(&p4api.StreamMessageRequest{
+		Update: &p4api.StreamMessageRequest_Packet{
+			Packet: &p4api.PacketOut{
+				Payload:  payload,
+				Metadata: c.codec.EncodePacketOutMetadata(&p4utils.PacketOutMetadata{EgressPort: portNumber}),
+			}},
+	})
+}
+
+// Returns the table entry with the given matches that sends the matching packets to the CPU using the given action
+func puntEntry(tableID uint32, action *aclActionIDs, matches ...*p4api.FieldMatch) *p4api.TableEntry {
+	return &p4api.TableEntry{
+		TableId: tableID,
+		Match:   matches,
+		Action: &p4api.TableAction{
+			Type: &p4api.TableAction_Action{
+				Action: &p4api.Action{
+					ActionId: action.actionID,
+					Params:   []*p4api.Action_Param{{ParamId: action.setRoleAgentParamID, Value: []byte(linkAgentRoleID)}},
+				},
+			},
+		},
+	}
+}
+
+// Returns true if the given table entries have the same match key, i.e. one can be modified into the other
+func sameMatchKey(a *p4api.TableEntry, b *p4api.TableEntry) bool {
+	return proto.Equal(&p4api.TableEntry{TableId: a.TableId, Match: a.Match, Priority: a.Priority},
+		&p4api.TableEntry{TableId: b.TableId, Match: b.Match, Priority: b.Priority})
+}
+
+// Inserts, modifies or deletes the given table entry, per the given update type
+func (c *Controller) writeTableEntry(updateType p4api.Update_Type, entry *p4api.TableEntry) error {
+	ctx, cancel := c.requestContext(c.ctx)
+	defer cancel()
+	_, err := c.p4Client.Write(ctx, &p4api.WriteRequest{
 		DeviceId:   c.chassisID,
 		Role:       linkAgentRoleName,
 		ElectionId: c.electionID,
 		Updates: []*p4api.Update{{
-			Type: p4api.Update_INSERT,
-			Entity: &p4api.Entity{Entity: &p4api.Entity_TableEntry{
-				TableEntry: &p4api.TableEntry{
-					TableId: tableID,
-					Match: []*p4api.FieldMatch{{
-						FieldId: ethTypeMatchFieldID,
-						FieldMatchType: &p4api.FieldMatch_Ternary_{
-							Ternary: &p4api.FieldMatch_Ternary{
-								Value: ethTypeValue,
-								Mask:  []byte{0xff, 0xff},
-							},
-						},
-					}},
-					Action: &p4api.TableAction{
-						Type: &p4api.TableAction_Action{
-							Action: &p4api.Action{
-								ActionId: actionID,
-								Params:   []*p4api.Action_Param{{ParamId: setRoleAgentParamID, Value: []byte(linkAgentRoleID)}},
-							},
-						},
-					},
-				}}},
+			Type:   updateType,
+			Entity: &p4api.Entity{Entity: &p4api.Entity_TableEntry{TableEntry: entry}},
 		}},
 	})
 	return err
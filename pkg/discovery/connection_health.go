@@ -0,0 +1,128 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"math/rand"
+	"time"
+)
+
+const (
+	connectPhase     = "connect"
+	pipelinePhase    = "pipeline"
+	arbitrationPhase = "arbitration"
+
+	// Fraction of the retry pause by which it is randomly lengthened or shortened
+	retryJitter = 0.2
+)
+
+// Auxiliary state for tracking health of the connection to the Stratum agent
+type connectionHealth struct {
+	retries       map[string]int64
+	lastError     string
+	lastErrorTime time.Time
+}
+
+// Records a failed attempt in the given connection phase and returns how long to pause before the next attempt
+func (c *Controller) recordFailure(phase string, err error) time.Duration {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.health.retries[phase]++
+	retries := c.health.retries[phase]
+	c.health.lastError = fmt.Sprintf("%s: %v", phase, err)
+	c.health.lastErrorTime = c.now()
+	c.updateTree(
+		treeLeaf{fmt.Sprintf("state/connection/%s-retries", phase), intVal(retries)},
+		treeLeaf{"state/connection/last-error", stringVal(c.health.lastError)},
+		treeLeaf{"state/connection/last-error-time", uintVal(uint64(c.health.lastErrorTime.UnixNano()))},
+	)
+	minPause, maxPause := time.Duration(c.config.RetryMinPause)*time.Second, time.Duration(c.config.RetryMaxPause)*time.Second
+	return withJitter(exponentialPause(minPause, maxPause, int(retries)))
+}
+
+// Records a successful attempt in the given connection phase, resetting its retry count
+func (c *Controller) recordSuccess(phase string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.health.retries[phase] > 0 {
+		c.health.retries[phase] = 0
+		c.updateTree(treeLeaf{fmt.Sprintf("state/connection/%s-retries", phase), intVal(0)})
+	}
+}
+
+// Returns context for a single request to the Stratum agent, limited by the configured request timeout
+func (c *Controller) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, c.requestTimeout())
+}
+
+// Returns the configured timeout for a single request to the Stratum agent
+func (c *Controller) requestTimeout() time.Duration {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.config.RequestTimeout < 1 {
+		return time.Second
+	}
+	return time.Duration(c.config.RequestTimeout) * time.Second
+}
+
+// Watches the connectivity state of the given connection and drops back to disconnected state if the connection fails
+func (c *Controller) monitorConnectivity(ctx context.Context, conn *grpc.ClientConn) {
+	for state := conn.GetState(); ; state = conn.GetState() {
+		c.lock.Lock()
+		c.updateTree(treeLeaf{"state/connection/status", stringVal(state.String())})
+		c.lock.Unlock()
+		if state == connectivity.TransientFailure || state == connectivity.Shutdown {
+			if ctx.Err() == nil {
+				log.Warnf("Connection to stratum agent failed: %s", state)
+				c.recordFailure(connectPhase, fmt.Errorf("connection entered %s state", state))
+				c.lock.Lock()
+				if c.state != Stopped {
+					c.changeState(Disconnected, fmt.Sprintf("connection entered %s state", state))
+				}
+				c.lock.Unlock()
+			}
+			return
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return
+		}
+	}
+}
+
+// Closes the current connection to the Stratum agent, if any, along with its stream channel and port monitor
+func (c *Controller) closeConnection() {
+	c.closeStream()
+	c.lock.Lock()
+	c.monitor.stop()
+	c.lock.Unlock()
+	if c.ctxCancel != nil {
+		c.ctxCancel()
+	}
+	if c.conn != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+	}
+}
+
+// Returns the pause for the given attempt, starting with the minimum and doubling with each attempt, up to the maximum
+func exponentialPause(minPause time.Duration, maxPause time.Duration, attempt int) time.Duration {
+	pause := minPause
+	for i := 1; i < attempt && pause < maxPause; i++ {
+		pause = 2 * pause
+	}
+	if pause > maxPause {
+		pause = maxPause
+	}
+	return pause
+}
+
+// Returns the given pause randomly lengthened or shortened by up to the jitter fraction
+func withJitter(pause time.Duration) time.Duration {
+	return pause + time.Duration((2*rand.Float64()-1)*retryJitter*float64(pause))
+}
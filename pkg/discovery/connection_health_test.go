@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestExponentialPause(t *testing.T) {
+	assert.Equal(t, time.Second, exponentialPause(time.Second, 30*time.Second, 0))
+	assert.Equal(t, time.Second, exponentialPause(time.Second, 30*time.Second, 1))
+	assert.Equal(t, 2*time.Second, exponentialPause(time.Second, 30*time.Second, 2))
+	assert.Equal(t, 16*time.Second, exponentialPause(time.Second, 30*time.Second, 5))
+	assert.Equal(t, 30*time.Second, exponentialPause(time.Second, 30*time.Second, 6))
+	assert.Equal(t, 30*time.Second, exponentialPause(time.Second, 30*time.Second, 1000))
+}
+
+func TestWithJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		pause := withJitter(10 * time.Second)
+		assert.True(t, pause >= 8*time.Second && pause <= 12*time.Second)
+	}
+}
+
+func TestController_RecordFailureAndSuccess(t *testing.T) {
+	c, _ := newTestController(t)
+	c.config.RetryMinPause = 1
+	c.config.RetryMaxPause = 4
+
+	c.recordFailure(connectPhase, errors.New("boom"))
+	c.recordFailure(connectPhase, errors.New("bang"))
+	pause := c.recordFailure(connectPhase, errors.New("bust"))
+	assert.True(t, pause >= 3200*time.Millisecond && pause <= 4800*time.Millisecond)
+
+	assert.Equal(t, int64(3), c.Root().GetPath("state/connection/connect-retries").Value().GetIntVal())
+	assert.Equal(t, "connect: bust", c.Root().GetPath("state/connection/last-error").Value().GetStringVal())
+	assert.NotZero(t, c.Root().GetPath("state/connection/last-error-time").Value().GetUintVal())
+
+	c.recordSuccess(connectPhase)
+	assert.Equal(t, int64(0), c.Root().GetPath("state/connection/connect-retries").Value().GetIntVal())
+	assert.Equal(t, "connect: bust", c.Root().GetPath("state/connection/last-error").Value().GetStringVal())
+}
+
+func TestController_MonitorConnectivity(t *testing.T) {
+	c, _ := newTestController(t)
+	c.setState(Configured, "test")
+
+	// Grab a free port and close the listener, so that connection attempts get refused
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	address := lis.Addr().String()
+	_ = lis.Close()
+
+	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	defer conn.Close()
+	conn.Connect()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.monitorConnectivity(ctx, conn)
+
+	assert.Eventually(t, func() bool { return c.getState() == Disconnected }, 10*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(1), c.Root().GetPath("state/connection/connect-retries").Value().GetIntVal())
+}
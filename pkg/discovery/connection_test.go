@@ -0,0 +1,182 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"context"
+	p4api "github.com/p4lang/p4runtime/go/p4/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Fake switch arbitrating mastership among the stream channels of its clients, i.e. the highest election ID wins
+type fakeArbiter struct {
+	lock    sync.Mutex
+	streams []*fakeStream
+	primary *fakeStream
+}
+
+// Fake P4Runtime client whose stream channels are arbitrated by the given arbiter
+type fakeP4Client struct {
+	p4api.P4RuntimeClient
+	arbiter *fakeArbiter
+}
+
+func (f *fakeP4Client) StreamChannel(ctx context.Context, opts ...grpc.CallOption) (p4api.P4Runtime_StreamChannelClient, error) {
+	stream := &fakeStream{ctx: ctx, arbiter: f.arbiter, responses: make(chan *p4api.StreamMessageResponse, 16)}
+	f.arbiter.lock.Lock()
+	defer f.arbiter.lock.Unlock()
+	f.arbiter.streams = append(f.arbiter.streams, stream)
+	return stream, nil
+}
+
+type fakeStream struct {
+	grpc.ClientStream
+	ctx        context.Context
+	arbiter    *fakeArbiter
+	electionID *p4api.Uint128
+	responses  chan *p4api.StreamMessageResponse
+}
+
+func (s *fakeStream) Send(msg *p4api.StreamMessageRequest) error {
+	a := s.arbiter
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	s.electionID = msg.GetArbitration().ElectionId
+	primary := s
+	for _, other := range a.streams {
+		if other.electionID != nil && higherElectionID(other.electionID, primary.electionID) {
+			primary = other
+		}
+	}
+	changed := primary != a.primary
+	a.primary = primary
+	for _, other := range a.streams {
+		if other == s || (changed && other.electionID != nil) {
+			code := codes.AlreadyExists
+			if other == primary {
+				code = codes.OK
+			}
+			other.responses <- &p4api.StreamMessageResponse{Update: &p4api.StreamMessageResponse_Arbitration{
+				Arbitration: &p4api.MasterArbitrationUpdate{ElectionId: other.electionID, Status: &status.Status{Code: int32(code)}},
+			}}
+		}
+	}
+	return nil
+}
+
+func (s *fakeStream) Recv() (*p4api.StreamMessageResponse, error) {
+	select {
+	case msg := <-s.responses:
+		return msg, nil
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+func higherElectionID(a *p4api.Uint128, b *p4api.Uint128) bool {
+	return a.High > b.High || (a.High == b.High && a.Low > b.Low)
+}
+
+func newArbitrationTestController(t *testing.T, ctx context.Context, arbiter *fakeArbiter) *Controller {
+	c, _ := newTestController(t)
+	c.ctx = ctx
+	c.p4Client = &fakeP4Client{arbiter: arbiter}
+	c.setState(PipelineConfigAvailable, "test")
+	return c
+}
+
+func TestController_MastershipArbitration(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	arbiter := &fakeArbiter{}
+
+	// The first agent wins with its backup election ID, but replaces it with a time-based one at once
+	first := newArbitrationTestController(t, ctx, arbiter)
+	first.waitForMastershipArbitration()
+	assert.Equal(t, Elected, first.getState())
+	assert.False(t, isBackupElectionID(first.electionID))
+
+	// The agent started later stands by, rather than winning over the primary with its higher backup election ID
+	second := newArbitrationTestController(t, ctx, arbiter)
+	second.waitForMastershipArbitration()
+	assert.Equal(t, Standby, second.getState())
+	assert.True(t, isBackupElectionID(second.electionID))
+	assert.Equal(t, Elected, first.getState())
+	assert.Equal(t, standby, second.Root().GetPath(mastershipPath).Value().GetStringVal())
+}
+
+func TestController_ProcessArbitrationUpdate(t *testing.T) {
+	c, clock := newTestController(t)
+	c.electionID = &p4api.Uint128{High: 0, Low: 100}
+	c.electedAt = clock.now()
+	c.setState(Configured, "test")
+
+	// Arbitration update confirming our mastership should not change anything
+	c.processArbitrationUpdate(&p4api.MasterArbitrationUpdate{
+		ElectionId: &p4api.Uint128{High: 0, Low: 100},
+		Status:     &status.Status{Code: int32(codes.OK)},
+	})
+	assert.Equal(t, Configured, c.getState())
+
+	// Arbitration update with a higher election ID means we got demoted
+	c.processArbitrationUpdate(&p4api.MasterArbitrationUpdate{
+		ElectionId: &p4api.Uint128{High: 0, Low: 200},
+		Status:     &status.Status{Code: int32(codes.AlreadyExists)},
+	})
+	assert.Equal(t, Standby, c.getState())
+	assert.Equal(t, 1, c.demotions)
+
+	// Another demotion shortly after re-election should extend the backoff
+	c.setState(Configured, "test")
+	clock.advance(10 * time.Second)
+	c.processArbitrationUpdate(&p4api.MasterArbitrationUpdate{
+		ElectionId: &p4api.Uint128{High: 0, Low: 300},
+	})
+	assert.Equal(t, Standby, c.getState())
+	assert.Equal(t, 2, c.demotions)
+
+	// Demotion after holding mastership for long enough should reset the backoff
+	c.setState(Configured, "test")
+	clock.advance(time.Hour)
+	c.processArbitrationUpdate(&p4api.MasterArbitrationUpdate{
+		ElectionId: &p4api.Uint128{High: 0, Low: 400},
+	})
+	assert.Equal(t, 1, c.demotions)
+}
+
+func TestController_ProcessArbitrationPromotion(t *testing.T) {
+	c, _ := newTestController(t)
+	c.electionID = &p4api.Uint128{High: 0, Low: 100}
+	c.setState(Standby, "test")
+
+	// Arbitration update naming another primary should keep us standing by
+	c.processArbitrationUpdate(&p4api.MasterArbitrationUpdate{
+		ElectionId: &p4api.Uint128{High: 0, Low: 200},
+		Status:     &status.Status{Code: int32(codes.AlreadyExists)},
+	})
+	assert.Equal(t, Standby, c.getState())
+
+	// Arbitration update naming us as the primary should promote us
+	c.processArbitrationUpdate(&p4api.MasterArbitrationUpdate{
+		ElectionId: &p4api.Uint128{High: 0, Low: 100},
+		Status:     &status.Status{Code: int32(codes.OK)},
+	})
+	assert.Equal(t, Elected, c.getState())
+	assert.Equal(t, primary, c.Root().GetPath(mastershipPath).Value().GetStringVal())
+}
+
+func TestStandbyPause(t *testing.T) {
+	assert.Equal(t, mastershipArbitrationRetryPause, standbyPause(0))
+	assert.Equal(t, mastershipArbitrationRetryPause, standbyPause(1))
+	assert.Equal(t, 2*mastershipArbitrationRetryPause, standbyPause(2))
+	assert.Equal(t, 4*mastershipArbitrationRetryPause, standbyPause(3))
+	assert.Equal(t, maxStandbyPause, standbyPause(100))
+}
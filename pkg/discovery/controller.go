@@ -7,6 +7,7 @@ package discovery
 
 import (
 	"context"
+	"fmt"
 	"github.com/onosproject/onos-lib-go/pkg/logging"
 	"github.com/onosproject/onos-net-lib/pkg/configtree"
 	"github.com/onosproject/onos-net-lib/pkg/p4utils"
@@ -15,6 +16,7 @@ import (
 	p4api "github.com/p4lang/p4runtime/go/p4/v1"
 	"google.golang.org/grpc"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -41,8 +43,33 @@ const (
 	Reconfigured
 	// Stopped represents state where the link agent has been issued a stop command
 	Stopped
+	// Standby represents state where the link agent has been demoted from mastership for its role
+	Standby
 )
 
+var stateNames = map[State]string{
+	Disconnected:            "Disconnected",
+	Connected:               "Connected",
+	PipelineConfigAvailable: "PipelineConfigAvailable",
+	Elected:                 "Elected",
+	PortsDiscovered:         "PortsDiscovered",
+	Configured:              "Configured",
+	Reconfigured:            "Reconfigured",
+	Stopped:                 "Stopped",
+	Standby:                 "Standby",
+}
+
+// String returns the name of the state
+func (s State) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// Maximum number of state transitions retained in the config tree
+const maxTransitionHistory = 32
+
 // Controller represents the link discovery control
 type Controller struct {
 	configtree.Configurable
@@ -50,13 +77,29 @@ type Controller struct {
 
 	TargetAddress   string
 	IngressDeviceID string
-
-	state  State
-	lock   sync.RWMutex
-	config *Config
-	ports  map[string]*Port
-	links  map[uint32]*Link
-	hosts  map[string]*Host
+	PeerAddresses   []string
+	TargetTLS       TLSConfig
+	PeerTLS         TLSConfig
+	PeerNoTLS       bool
+	PeerTokenPath   string
+
+	state                State
+	stateChanged         chan struct{}
+	transitionSeq        uint64
+	hostEventSeq         uint64
+	lock                 sync.RWMutex
+	config               *Config
+	exclusions           *exclusions
+	ports                map[string]*Port
+	links                map[linkKey]*Link
+	flaps                map[linkKey]*flapState
+	lldpAuth             lldpAuthState
+	hostProbes           hostProbeState
+	probeSequence        uint32
+	programmedIntercepts map[string]*p4api.TableEntry
+	dhcpClients          map[string]*dhcpClient
+	echoes               map[linkKey]*probeEcho
+	hosts                map[hostKey]*Host
 
 	conn       *grpc.ClientConn
 	p4Client   p4api.P4RuntimeClient
@@ -65,15 +108,25 @@ type Controller struct {
 	ctx       context.Context
 	ctxCancel context.CancelFunc
 
-	chassisID  uint64
-	info       *p4info.P4Info
-	codec      *p4utils.ControllerMetadataCodec
-	stream     p4api.P4Runtime_StreamChannelClient
-	electionID *p4api.Uint128
-	cookie     uint64
-	role       *p4api.Role
-
-	monitor *portMonitor
+	chassisID    uint64
+	info         *p4info.P4Info
+	codec        *p4utils.ControllerMetadataCodec
+	stream       p4api.P4Runtime_StreamChannelClient
+	streamCancel context.CancelFunc
+	electionID   *p4api.Uint128
+	cookie       uint64
+	role         *p4api.Role
+	electedAt    time.Time
+	demotions    int
+
+	monitor        *portMonitor
+	health         connectionHealth
+	peerConns      map[string]*grpc.ClientConn
+	certLoader     *certLoader
+	peerCertLoader *certLoader
+
+	// Source of the current time; not a direct time.Now call for testing purposes
+	now func() time.Time
 }
 
 // Port holds data about each discovered switch ports
@@ -86,32 +139,95 @@ type Port struct {
 
 // Link holds data about each discovered ingress links
 type Link struct {
-	EgressPort     uint32
+	EgressPort     uint32 // numeric form of the egress port ID, if available; 0 otherwise
+	EgressPortID   string
 	EgressDeviceID string
 	IngressPort    uint32
+	VLAN           string // VLAN tags of the LLDP packets, e.g. 100, or 100.200 if double-tagged; empty if untagged
 	LastUpdate     time.Time
+	Neighbor       *Neighbor
+	Authenticated  *bool // nil unless LLDP packets are authenticated per the flag policy
+	Bidirectional  *bool // nil unless the link has been confirmed, or not, by the digest of its neighbor
+	Indirect       *bool // nil unless BDDP is enabled; true if the link is learned only via BDDP
+
+	OneWayLatency    *LatencyStats
+	RoundTripLatency *LatencyStats
+
+	ProbesExpected int64
+	ProbesReceived int64
+	Degraded       bool // true if the loss of probes exceeds the configured threshold
+	lastSequence   uint32
+	recentProbes   uint64 // receipt of the most recently expected probes, the latest in the lowest bit
+	recentCount    int64
+
+	confirmationMisses int
+	lastDirectUpdate   time.Time // time of the last LLDP packet, as opposed to BDDP packet
+}
+
+// Key uniquely identifying an ingress link; a single ingress port may have links to several neighbors, e.g. on a
+// shared segment, and to the same neighbor on several VLANs, e.g. on a tagged trunk
+type linkKey struct {
+	ingressPort    uint32
+	egressDeviceID string
+	egressPortID   string
+	vlan           string
+}
+
+// Returns the key of the link
+func (l *Link) key() linkKey {
+	return linkKey{ingressPort: l.IngressPort, egressDeviceID: l.EgressDeviceID, egressPortID: l.EgressPortID, vlan: l.VLAN}
 }
 
 // Host is a simple representation of a host network interface discovered by the ONOS lite
 type Host struct {
 	MAC        string
-	IP         string
+	VLAN       string   // VLAN tags of the packets, e.g. 100, or 100.200 if double-tagged; empty if untagged
+	IPs        []string // sorted
 	Port       uint32
 	LastUpdate time.Time
+	Moves      int                  // number of times the host has been seen moving to another port
+	Lease      *DHCPLease           // nil unless the host has been learned via DHCP
+	addresses  map[string]time.Time // time of the last update of each IP address
+}
+
+// Key uniquely identifying a host; the same MAC may be used on several VLANs
+type hostKey struct {
+	mac  string
+	vlan string
+}
+
+// Returns the key of the host
+func (h *Host) key() hostKey {
+	return hostKey{mac: h.MAC, vlan: h.VLAN}
 }
 
 // NewController creates a new link discovery controller
 func NewController(targetAddress string, agentID string) *Controller {
 	config := loadConfig()
 	ctrl := &Controller{
-		GNMIConfigurable: *configtree.NewGNMIConfigurable(createConfigRoot(agentID, config)),
-		TargetAddress:    targetAddress,
-		IngressDeviceID:  agentID,
-		config:           config,
-		ports:            make(map[string]*Port),
-		links:            make(map[uint32]*Link),
-		hosts:            make(map[string]*Host),
-		monitor:          &portMonitor{},
+		GNMIConfigurable:     *configtree.NewGNMIConfigurable(createConfigRoot(agentID, config)),
+		TargetAddress:        targetAddress,
+		IngressDeviceID:      agentID,
+		TargetTLS:            config.TargetTLS,
+		config:               config,
+		exclusions:           newExclusions(config),
+		stateChanged:         make(chan struct{}, 1),
+		ports:                make(map[string]*Port),
+		links:                make(map[linkKey]*Link),
+		flaps:                make(map[linkKey]*flapState),
+		echoes:               make(map[linkKey]*probeEcho),
+		programmedIntercepts: make(map[string]*p4api.TableEntry),
+		dhcpClients:          make(map[string]*dhcpClient),
+		lldpAuth: lldpAuthState{
+			lastTimestamps: make(map[lldpSender]uint64),
+			failures:       make(map[string]int64),
+		},
+		hostProbes: hostProbeState{probedAt: make(map[hostAddress]time.Time)},
+		hosts:      make(map[hostKey]*Host),
+		monitor:    &portMonitor{},
+		health:     connectionHealth{retries: make(map[string]int64)},
+		peerConns:  make(map[string]*grpc.ClientConn),
+		now:        time.Now,
 	}
 	ctrl.GNMIConfigurable.Configurable = ctrl
 	return ctrl
@@ -126,67 +242,145 @@ func (c *Controller) Start() {
 // Stop stops the controller
 func (c *Controller) Stop() {
 	log.Infof("Stopping...")
-	c.setState(Stopped)
+	c.setState(Stopped, "stop requested")
 	if c.ctxCancel != nil {
 		c.ctxCancel()
 	}
+	c.closePeerConns(nil)
 }
 
-// GetLinks returns a list of currently discovered links, sorted by ingress port
+// GetLinks returns a list of currently discovered links, excluding any suppressed flapping links, sorted by ingress
+// port, egress device and egress port
 func (c *Controller) GetLinks() []*Link {
 	c.lock.RLock()
 	defer c.lock.RUnlock()
 
 	links := make([]*Link, 0, len(c.links))
-	for _, link := range c.links {
-		links = append(links, link)
+	for key, link := range c.links {
+		if !c.isLinkSuppressed(key) {
+			links = append(links, link)
+		}
 	}
 
-	sort.SliceStable(links, func(i, j int) bool { return links[i].IngressPort < links[j].IngressPort })
+	sort.SliceStable(links, func(i, j int) bool {
+		if links[i].IngressPort != links[j].IngressPort {
+			return links[i].IngressPort < links[j].IngressPort
+		}
+		if links[i].EgressDeviceID != links[j].EgressDeviceID {
+			return links[i].EgressDeviceID < links[j].EgressDeviceID
+		}
+		if links[i].EgressPort != links[j].EgressPort {
+			return links[i].EgressPort < links[j].EgressPort
+		}
+		return links[i].EgressPortID < links[j].EgressPortID
+	})
 	return links
 }
 
-func (c *Controller) updateIngressLink(ingressPort uint32, egressPort uint32, egressDeviceID string) {
+func (c *Controller) updateIngressLink(ingressPort uint32, egressPortID string, egressDeviceID string, vlan string) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	link, ok := c.links[ingressPort]
-	if !ok || link.EgressPort != egressPort || link.EgressDeviceID != egressDeviceID {
+	if c.exclusions.isPortExcluded(ingressPort) {
+		return
+	}
+	key := linkKey{ingressPort: ingressPort, egressDeviceID: egressDeviceID, egressPortID: egressPortID, vlan: vlan}
+	link, ok := c.links[key]
+	if !ok {
+		// Legacy link paths can hold only one neighbor per ingress port, so the new one replaces any others
+		if c.config.LegacyLinkPaths {
+			c.deleteIngressLinks(ingressPort)
+		}
+
 		link = &Link{
-			EgressPort:     egressPort,
+			EgressPort:     numericPortID(egressPortID),
+			EgressPortID:   egressPortID,
 			EgressDeviceID: egressDeviceID,
 			IngressPort:    ingressPort,
+			VLAN:           vlan,
 		}
 
-		// Add the link to our internal structure and to the config tree
-		c.links[ingressPort] = link
-		log.Infof("Added a new link: %d <- %s/%d", ingressPort, egressDeviceID, egressPort)
-		c.addLinkToTree(ingressPort, egressPort, egressDeviceID)
+		// Add the link to our internal structure and, unless it is suppressed, to the config tree
+		c.links[key] = link
+		if c.isLinkSuppressed(key) {
+			log.Infof("Added a new suppressed link: %d <- %s/%s", ingressPort, egressDeviceID, egressPortID)
+		} else {
+			log.Infof("Added a new link: %d <- %s/%s", ingressPort, egressDeviceID, egressPortID)
+			c.addLinkToTree(link)
+		}
 	}
-	link.LastUpdate = time.Now()
+	link.LastUpdate = c.now()
 }
 
+// Releases any suppressed links that are no longer flapping, marks links degraded due to loss, and prunes links that
+// have not been refreshed within their max age
 func (c *Controller) pruneLinks() {
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	limit := time.Now().Add(-30 * time.Second)
-	for ingressPort, link := range c.links {
-		if link.LastUpdate.Before(limit) {
-			c.deleteLink(ingressPort)
-			log.Infof("Pruned stale link: %d <- %s/%d", link.IngressPort, link.EgressDeviceID, link.EgressPort)
+	c.reuseLinks()
+	c.degradeLinks()
+	now := c.now()
+	for key, link := range c.links {
+		if maxAge := c.maxLinkAge(link); maxAge > 0 && link.LastUpdate.Before(now.Add(-maxAge)) {
+			c.withdrawLink(key)
+			log.Infof("Pruned stale link: %d <- %s/%s", link.IngressPort, link.EgressDeviceID, link.EgressPortID)
 		}
 	}
 }
 
-func (c *Controller) deleteLink(ingressPort uint32) {
-	// Delete the link from our internal structure and from the config tree
-	delete(c.links, ingressPort)
-	c.removeLinkFromTree(ingressPort)
+func (c *Controller) deleteLink(key linkKey) {
+	// Delete the link from our internal structure and from the config tree; suppressed links are not in the tree
+	delete(c.links, key)
+	delete(c.echoes, key)
+	if !c.isLinkSuppressed(key) {
+		c.removeLinkFromTree(key)
+	}
+}
+
+// Deletes all links on the given ingress port; must be called with lock held
+func (c *Controller) deleteIngressLinks(ingressPort uint32) {
+	for key := range c.links {
+		if key.ingressPort == ingressPort {
+			c.deleteLink(key)
+		}
+	}
 }
 
-func (c *Controller) deleteHost(macString string) {
+// Re-publishes all links under the legacy or the current link paths; when switching to legacy link paths, only the
+// most recently updated link on each ingress port is retained; must be called with lock held
+func (c *Controller) switchLinkPaths(legacyLinkPaths bool) {
+	for key := range c.links {
+		if !c.isLinkSuppressed(key) {
+			c.removeLinkFromTree(key)
+		}
+	}
+	c.config.LegacyLinkPaths = legacyLinkPaths
+
+	if legacyLinkPaths {
+		latest := make(map[uint32]*Link)
+		for _, link := range c.links {
+			if other, ok := latest[link.IngressPort]; !ok || link.LastUpdate.After(other.LastUpdate) {
+				latest[link.IngressPort] = link
+			}
+		}
+		for key := range c.links {
+			if latest[key.ingressPort].key() != key {
+				delete(c.links, key)
+			}
+		}
+	}
+
+	for key, link := range c.links {
+		if !c.isLinkSuppressed(key) {
+			c.addLinkToTree(link)
+		}
+	}
+	log.Infof("Switched link paths; legacy link paths: %t", legacyLinkPaths)
+}
+
+func (c *Controller) deleteHost(key hostKey) {
 	// Delete the link from our internal structure and from the config tree
-	delete(c.hosts, macString)
-	c.removeHostFromTree(macString)
+	delete(c.hosts, key)
+	c.removeHostFromTree(key)
 }
 
 // Get the current operational state
@@ -197,47 +391,156 @@ func (c *Controller) getState() State {
 	return state
 }
 
-// Change state to the new state
-func (c *Controller) setState(state State) {
+// Change state to the new state for the given reason
+func (c *Controller) setState(state State, reason string) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	c.state = state
+	c.changeState(state, reason)
 }
 
-// Change state to the new state, but only if in the given condition state
-func (c *Controller) setStateIf(condition State, state State) {
+// Change state to the new state for the given reason, but only if in the given condition state
+func (c *Controller) setStateIf(condition State, state State, reason string) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 	if c.state == condition {
+		c.changeState(state, reason)
+	}
+}
+
+// Changes the state, records the transition and wakes up anyone waiting for state change; must be called with lock held
+func (c *Controller) changeState(state State, reason string) {
+	if c.state != state {
+		log.Infof("Transitioning from %s to %s: %s", c.state, state, reason)
+		c.recordTransition(c.state, state, reason)
 		c.state = state
+		c.notifyStateChanged()
+	}
+}
+
+// Records the state transition in the config tree, retaining only a limited history of transitions, and forwards
+// the changes to any subscribe responders
+func (c *Controller) recordTransition(from State, to State, reason string) {
+	c.transitionSeq++
+	now := uintVal(uint64(c.now().UnixNano()))
+	c.updateTree(
+		treeLeaf{"state/controller/state", stringVal(to.String())},
+		treeLeaf{"state/controller/last-transition-time", now},
+		treeLeaf{fmt.Sprintf("state/controller/transition[seq=%d]/from", c.transitionSeq), stringVal(from.String())},
+		treeLeaf{fmt.Sprintf("state/controller/transition[seq=%d]/to", c.transitionSeq), stringVal(to.String())},
+		treeLeaf{fmt.Sprintf("state/controller/transition[seq=%d]/reason", c.transitionSeq), stringVal(reason)},
+		treeLeaf{fmt.Sprintf("state/controller/transition[seq=%d]/time", c.transitionSeq), now},
+	)
+	if c.transitionSeq > maxTransitionHistory {
+		c.deleteFromTree(fmt.Sprintf("state/controller/transition[seq=%d]", c.transitionSeq-maxTransitionHistory))
 	}
 }
 
-func (c *Controller) updateHost(macString string, ipString string, port uint32) {
+// Wakes up anyone waiting for state change, without blocking
+func (c *Controller) notifyStateChanged() {
+	select {
+	case c.stateChanged <- struct{}{}:
+	default:
+	}
+}
+
+// Updates the host with the given MAC and VLAN, adding the given IP address to its addresses; host discovered on a
+// different port is considered to have moved, and its addresses are learned anew
+func (c *Controller) updateHost(key hostKey, ipString string, port uint32) {
+	c.learnHost(key, ipString, port, "")
+}
+
+// Updates the host as per updateHost, recording host moves and IP address conflicts as host events attributed to
+// the given source; no events are recorded for an empty source, e.g. for hosts mirrored from the primary peer
+func (c *Controller) learnHost(key hostKey, ipString string, port uint32, source string) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	host, ok := c.hosts[macString]
-	if !ok || host.MAC != macString || host.IP != ipString || host.Port != port {
+	if c.exclusions.isHostExcluded(key.mac, ipString, port) {
+		return
+	}
+	moved, moves, movedFrom := false, 0, uint32(0)
+	host, ok := c.hosts[key]
+	if ok && host.Port != port {
+		moved, moves, movedFrom = true, host.Moves, host.Port
+		c.deleteHost(key)
+		ok = false
+	}
+	if !ok {
 		host = &Host{
-			MAC:  macString,
-			IP:   ipString,
-			Port: port,
+			MAC:       key.mac,
+			VLAN:      key.vlan,
+			Port:      port,
+			Moves:     moves,
+			addresses: make(map[string]time.Time),
+		}
+		c.hosts[key] = host
+		log.Infof("Added a new host: %s/%s <- %d%s", key.mac, ipString, port, vlanSuffix(key.vlan))
+		c.addHostToTree(key, port)
+		if moved && source != "" {
+			c.recordHostMove(host, movedFrom, ipString, source)
 		}
-		c.hosts[macString] = host
-		log.Infof("Added a new host: %s/%s <- %d", macString, ipString, port)
-		c.addHostToTree(macString, ipString, port)
 	}
-	host.LastUpdate = time.Now()
+	if _, ok := host.addresses[ipString]; !ok {
+		host.addresses[ipString] = c.now()
+		host.IPs = sortedAddresses(host.addresses)
+		log.Infof("Added a new host address: %s/%s <- %d%s", key.mac, ipString, port, vlanSuffix(key.vlan))
+		c.addHostAddressToTree(key, ipString)
+		if source != "" {
+			c.detectIPConflicts(host, ipString, source)
+		}
+	}
+	host.addresses[ipString] = c.now()
+	host.LastUpdate = c.now()
+	c.noteHostProbeAnswer(key, ipString)
 }
 
+// Removes the given IP address from the given host; must be called with lock held
+func (c *Controller) deleteHostAddress(host *Host, ipString string) {
+	delete(host.addresses, ipString)
+	host.IPs = sortedAddresses(host.addresses)
+	c.removeHostAddressFromTree(host, ipString)
+}
+
+// Returns the sorted IP addresses of the given address map
+func sortedAddresses(addresses map[string]time.Time) []string {
+	ips := make([]string, 0, len(addresses))
+	for ip := range addresses {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+// Prunes hosts that have not been refreshed within the configured max host age, as well as such addresses of the
+// remaining hosts; 0 age disables pruning; leased addresses and the hosts holding them are retained until their
+// lease expires instead
 func (c *Controller) pruneHosts() {
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	limit := time.Now().Add(-30 * time.Minute) // this is to discuss
-	for mac, host := range c.hosts {
-		if host.LastUpdate.Before(limit) {
-			c.deleteHost(mac)
-			log.Infof("Pruned stale host: %s <- %s/%s", host.MAC, host.IP, host.Port)
+	c.pruneDHCPClients()
+	now := c.now()
+	limit := now.Add(-time.Duration(c.config.MaxHostAge) * time.Second)
+	for key, host := range c.hosts {
+		if host.Lease != nil && !host.Lease.Expiry.IsZero() && host.Lease.Expiry.Before(now) {
+			log.Infof("Expired host lease: %s <- %s/%d", host.MAC, host.Lease.Address, host.Port)
+			c.deleteHostLease(host)
+			if len(host.IPs) == 0 {
+				c.deleteHost(key)
+				continue
+			}
+		}
+		if c.config.MaxHostAge <= 0 {
+			continue
+		}
+		if host.Lease == nil && host.LastUpdate.Before(limit) {
+			c.deleteHost(key)
+			log.Infof("Pruned stale host: %s <- %s/%d", host.MAC, strings.Join(host.IPs, ","), host.Port)
+			continue
+		}
+		for ip, lastUpdate := range host.addresses {
+			if lastUpdate.Before(limit) && (host.Lease == nil || host.Lease.Address != ip) {
+				c.deleteHostAddress(host, ip)
+				log.Infof("Pruned stale host address: %s <- %s/%d", host.MAC, ip, host.Port)
+			}
 		}
 	}
 }
@@ -260,6 +563,8 @@ func (c *Controller) run() {
 			c.enterDiscovery()
 		case Reconfigured:
 			c.reenterDiscovery()
+		case Standby:
+			c.waitInStandby()
 		}
 	}
 	log.Infof("Stopped")
@@ -275,19 +580,22 @@ func (c *Controller) pauseIf(condition State, pause time.Duration) {
 func (c *Controller) setupForDiscovery() {
 	// Program intercept rule(s)
 	c.programPacketInterceptRules()
-	c.setState(Configured)
-
-	// Setup packet-in handler
-	go c.handlePackets()
+	c.setState(Configured, "intercept rules programmed")
 }
 
 func (c *Controller) enterDiscovery() {
-	tLinks := time.NewTicker(time.Duration(c.config.EmitFrequency) * time.Second)
-	tConf := time.NewTicker(time.Duration(c.config.PipelineValidationFrequency) * time.Second)
-	tPorts := time.NewTicker(time.Duration(c.config.PortRediscoveryFrequency) * time.Second)
-	tPrune := time.NewTicker(time.Duration(c.config.LinkPruneFrequency) * time.Second)
+	c.lock.RLock()
+	tLinks := newTicker(c.config.EmitFrequency)
+	tConf := newTicker(c.config.PipelineValidationFrequency)
+	tPorts := newTicker(c.config.PortRediscoveryFrequency)
+	tPrune := newTicker(c.config.LinkPruneFrequency)
+	c.lock.RUnlock()
+
+	defer tLinks.Stop()
+	defer tConf.Stop()
+	defer tPorts.Stop()
+	defer tPrune.Stop()
 
-	// Do I have to emit ARP packets here? I guess so...
 	for c.getState() == Configured {
 		select {
 		// Periodically emit LLDP packets
@@ -302,14 +610,29 @@ func (c *Controller) enterDiscovery() {
 		case <-tConf.C:
 			c.validatePipelineConfiguration()
 
-		// Periodically prune links
+		// Periodically prune links and hosts, probing hosts about to expire
 		case <-tPrune.C:
 			c.pruneLinks()
 			c.pruneHosts()
+			c.probeHosts()
+
+		// Re-evaluate the state, e.g. to re-arm the tickers after reconfiguration
+		case <-c.stateChanged:
 		}
 	}
 }
 
+// Returns a new ticker with the given period in seconds; non-positive periods are treated as 1 second
+func newTicker(seconds int64) *time.Ticker {
+	if seconds < 1 {
+		seconds = 1
+	}
+	return time.NewTicker(time.Duration(seconds) * time.Second)
+}
+
 func (c *Controller) reenterDiscovery() {
-	c.setState(Configured)
+	log.Infof("Re-entering discovery with new configuration")
+	// Optional features, e.g. BDDP, or declared rules may have just been enabled, changed or disabled
+	c.syncInterceptRules()
+	c.setStateIf(Reconfigured, Configured, "discovery re-armed with new configuration")
 }
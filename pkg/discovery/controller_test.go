@@ -0,0 +1,242 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"fmt"
+	"github.com/onosproject/onos-api/go/onos/misc"
+	"github.com/openconfig/gnmi/proto/gnmi"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Creates a controller whose notion of current time is driven by the returned clock
+func newTestController(t *testing.T) (*Controller, *testClock) {
+	useTestConfigFile(t)
+	clock := &testClock{t: time.Unix(1000, 0)}
+	c := NewController("none", "123")
+	c.now = clock.now
+	return c, clock
+}
+
+type testClock struct {
+	t time.Time
+}
+
+func (tc *testClock) now() time.Time {
+	return tc.t
+}
+
+func (tc *testClock) advance(d time.Duration) {
+	tc.t = tc.t.Add(d)
+}
+
+// Subscribe responder that simply accumulates all responses sent to it
+type testResponder struct {
+	responses []*gnmi.SubscribeResponse
+}
+
+func (r *testResponder) GetConnection() *misc.Connection {
+	return &misc.Connection{}
+}
+
+func (r *testResponder) Send(response *gnmi.SubscribeResponse) {
+	r.responses = append(r.responses, response)
+}
+
+func TestController_PruneLinks(t *testing.T) {
+	c, clock := newTestController(t)
+	c.config.MaxLinkAge = 30
+
+	c.updateIngressLink(1, "10", "foo", "")
+	c.updateIngressLink(2, "20", "bar", "")
+	assert.Len(t, c.GetLinks(), 2)
+
+	clock.advance(20 * time.Second)
+	c.updateIngressLink(2, "20", "bar", "")
+	c.pruneLinks()
+	assert.Len(t, c.GetLinks(), 2)
+
+	clock.advance(15 * time.Second)
+	c.pruneLinks()
+	links := c.GetLinks()
+	assert.Len(t, links, 1)
+	assert.Equal(t, uint32(2), links[0].IngressPort)
+	assert.Nil(t, c.Root().GetPath("state/link[port=1,device=foo,egress-port=10]"))
+	assert.NotNil(t, c.Root().GetPath("state/link[port=2,device=bar,egress-port=20]"))
+
+	// Changing max link age should take effect on the next prune
+	c.config.MaxLinkAge = 10
+	c.pruneLinks()
+	assert.Len(t, c.GetLinks(), 0)
+}
+
+func TestController_PruneLinksDisabled(t *testing.T) {
+	c, clock := newTestController(t)
+	c.config.MaxLinkAge = 0
+
+	c.updateIngressLink(1, "10", "foo", "")
+	clock.advance(24 * time.Hour)
+	c.pruneLinks()
+	assert.Len(t, c.GetLinks(), 1)
+}
+
+func TestController_PruneHosts(t *testing.T) {
+	c, clock := newTestController(t)
+	c.config.MaxHostAge = 60
+
+	c.updateHost(hostKey{mac: "00:00:00:00:00:01"}, "10.0.0.1", 1)
+	c.updateHost(hostKey{mac: "00:00:00:00:00:02"}, "10.0.0.2", 2)
+	assert.Len(t, c.hosts, 2)
+
+	clock.advance(45 * time.Second)
+	c.updateHost(hostKey{mac: "00:00:00:00:00:02"}, "10.0.0.2", 2)
+	c.pruneHosts()
+	assert.Len(t, c.hosts, 2)
+
+	clock.advance(30 * time.Second)
+	c.pruneHosts()
+	assert.Len(t, c.hosts, 1)
+	assert.NotNil(t, c.hosts[hostKey{mac: "00:00:00:00:00:02"}])
+	assert.Nil(t, c.Root().GetPath("state/host[mac=00:00:00:00:00:01]"))
+
+	// Disabling pruning should retain even very stale hosts
+	c.config.MaxHostAge = 0
+	clock.advance(24 * time.Hour)
+	c.pruneHosts()
+	assert.Len(t, c.hosts, 1)
+}
+
+func TestController_ReconfigureRearmsDiscovery(t *testing.T) {
+	c, _ := newTestController(t)
+	for _, leaf := range []string{"emitFrequency", "pipelineValidationFrequency", "portRediscoveryFrequency", "linkPruneFrequency"} {
+		c.Root().AddPath("config/"+leaf, &gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: 3600}})
+	}
+	c.UpdateConfig()
+	c.setState(Configured, "test")
+
+	done := make(chan struct{})
+	go func() {
+		c.enterDiscovery()
+		close(done)
+	}()
+
+	c.Root().AddPath("config/emitFrequency", &gnmi.TypedValue{Value: &gnmi.TypedValue_IntVal{IntVal: 1800}})
+	c.UpdateConfig()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("discovery loop did not exit after reconfiguration")
+	}
+	assert.Equal(t, Reconfigured, c.getState())
+	assert.Equal(t, int64(1800), c.config.EmitFrequency)
+
+	c.reenterDiscovery()
+	assert.Equal(t, Configured, c.getState())
+}
+
+func TestController_StateTransitions(t *testing.T) {
+	c, clock := newTestController(t)
+	responder := &testResponder{}
+	c.AddSubscribeResponder(responder)
+	assert.Equal(t, "Disconnected", c.Root().GetPath("state/controller/state").Value().GetStringVal())
+
+	clock.advance(time.Second)
+	c.setState(Connected, "connected")
+	assert.Equal(t, "Connected", c.Root().GetPath("state/controller/state").Value().GetStringVal())
+	assert.Equal(t, uint64(clock.now().UnixNano()), c.Root().GetPath("state/controller/last-transition-time").Value().GetUintVal())
+	assert.Equal(t, "Disconnected", c.Root().GetPath("state/controller/transition[seq=1]/from").Value().GetStringVal())
+	assert.Equal(t, "Connected", c.Root().GetPath("state/controller/transition[seq=1]/to").Value().GetStringVal())
+	assert.Equal(t, "connected", c.Root().GetPath("state/controller/transition[seq=1]/reason").Value().GetStringVal())
+	assert.Len(t, responder.responses, 1)
+
+	// Conditional transition that does not apply should not be recorded
+	c.setStateIf(Elected, PortsDiscovered, "ports discovered")
+	assert.Equal(t, "Connected", c.Root().GetPath("state/controller/state").Value().GetStringVal())
+	assert.Len(t, responder.responses, 1)
+
+	// History should be bounded
+	for i := 0; i < maxTransitionHistory; i++ {
+		c.setState(Disconnected, fmt.Sprintf("disconnect %d", i))
+		c.setState(Connected, fmt.Sprintf("connect %d", i))
+	}
+	assert.Nil(t, c.Root().GetPath("state/controller/transition[seq=1]"))
+	assert.Len(t, c.Root().FindAll("state/controller/transition[seq=...]/reason"), maxTransitionHistory)
+	assert.Equal(t, "Stopped", Stopped.String())
+}
+
+func TestController_MultipleNeighborsPerPort(t *testing.T) {
+	c, clock := newTestController(t)
+	c.config.MaxLinkAge = 30
+
+	// Two neighbors on a shared segment should not displace each other
+	c.updateIngressLink(1, "10", "foo", "")
+	c.updateIngressLink(1, "20", "bar", "")
+	c.updateIngressLink(1, "10", "foo", "")
+	links := c.GetLinks()
+	assert.Len(t, links, 2)
+	assert.Equal(t, "bar", links[0].EgressDeviceID)
+	assert.Equal(t, "foo", links[1].EgressDeviceID)
+	assert.NotNil(t, c.Root().GetPath("state/link[port=1,device=foo,egress-port=10]/egress-device"))
+	assert.NotNil(t, c.Root().GetPath("state/link[port=1,device=bar,egress-port=20]/egress-device"))
+	assert.Len(t, c.Root().FindAll("state/link[port=...,device=...,egress-port=...]"), 8)
+
+	// Each neighbor should age out independently
+	clock.advance(20 * time.Second)
+	c.updateIngressLink(1, "10", "foo", "")
+	clock.advance(15 * time.Second)
+	c.pruneLinks()
+	links = c.GetLinks()
+	assert.Len(t, links, 1)
+	assert.Equal(t, "foo", links[0].EgressDeviceID)
+	assert.Nil(t, c.Root().GetPath("state/link[port=1,device=bar,egress-port=20]"))
+
+	// Port going down should remove all of its links
+	c.updateIngressLink(1, "20", "bar", "")
+	c.updateIngressLink(2, "20", "bar", "")
+	c.lock.Lock()
+	c.deleteIngressLinks(1)
+	c.lock.Unlock()
+	links = c.GetLinks()
+	assert.Len(t, links, 1)
+	assert.Equal(t, uint32(2), links[0].IngressPort)
+}
+
+func TestController_LegacyLinkPaths(t *testing.T) {
+	c, clock := newTestController(t)
+
+	c.updateIngressLink(1, "10", "foo", "")
+	clock.advance(time.Second)
+	c.updateIngressLink(1, "20", "bar", "")
+	c.updateIngressLink(2, "30", "baz", "")
+	assert.Len(t, c.GetLinks(), 3)
+
+	// Switching to legacy paths should retain only the latest neighbor on each port
+	c.Root().AddPath("config/legacyLinkPaths", &gnmi.TypedValue{Value: &gnmi.TypedValue_BoolVal{BoolVal: true}})
+	c.UpdateConfig()
+	assert.True(t, c.config.LegacyLinkPaths)
+	links := c.GetLinks()
+	assert.Len(t, links, 2)
+	assert.Equal(t, "bar", links[0].EgressDeviceID)
+	assert.Equal(t, int64(20), c.Root().GetPath("state/link[port=1]/egress-port").Value().GetIntVal())
+	assert.Nil(t, c.Root().GetPath("state/link[port=1,device=bar,egress-port=20]"))
+	assert.Len(t, c.Root().FindAll("state/link[port=...,device=...,egress-port=...]"), 0)
+
+	// In legacy mode, a new neighbor replaces the existing one
+	c.updateIngressLink(1, "10", "foo", "")
+	links = c.GetLinks()
+	assert.Len(t, links, 2)
+	assert.Equal(t, "foo", links[0].EgressDeviceID)
+	assert.Equal(t, "foo", c.Root().GetPath("state/link[port=1]/egress-device").Value().GetStringVal())
+
+	// Switching back should re-publish the links under the per-neighbor paths
+	c.Root().AddPath("config/legacyLinkPaths", &gnmi.TypedValue{Value: &gnmi.TypedValue_BoolVal{BoolVal: false}})
+	c.UpdateConfig()
+	assert.Nil(t, c.Root().GetPath("state/link[port=1]"))
+	assert.NotNil(t, c.Root().GetPath("state/link[port=1,device=foo,egress-port=10]"))
+	assert.NotNil(t, c.Root().GetPath("state/link[port=2,device=baz,egress-port=30]"))
+}
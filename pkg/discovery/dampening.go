@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Ceiling of the flap penalty, as a multiple of the suppress threshold; bounds how long a link remains suppressed
+// after it stops flapping
+const maxPenaltyMultiple = 4
+
+// Flap history of an ingress link; retained across the link being withdrawn and re-discovered
+type flapState struct {
+	flaps      int64
+	penalty    float64
+	updated    time.Time
+	suppressed bool
+}
+
+// Returns the penalty of the given flap history, decayed as of the given time
+func (c *Controller) decayedPenalty(fs *flapState, now time.Time) float64 {
+	if c.config.DampeningHalfLife <= 0 {
+		return fs.penalty
+	}
+	halfLives := now.Sub(fs.updated).Seconds() / float64(c.config.DampeningHalfLife)
+	return fs.penalty * math.Pow(0.5, halfLives)
+}
+
+// Returns true if the given link is presently suppressed; must be called with lock held
+func (c *Controller) isLinkSuppressed(key linkKey) bool {
+	fs, ok := c.flaps[key]
+	return ok && fs.suppressed
+}
+
+// Withdraws the given link and records the flap against it; must be called with lock held
+func (c *Controller) withdrawLink(key linkKey) {
+	c.deleteLink(key)
+	c.recordFlap(key)
+}
+
+// Penalizes the given link for a flap and suppresses it if the penalty exceeds the suppress threshold; must be
+// called with lock held
+func (c *Controller) recordFlap(key linkKey) {
+	if c.config.FlapPenalty <= 0 {
+		return
+	}
+	now := c.now()
+	fs, ok := c.flaps[key]
+	if !ok {
+		fs = &flapState{}
+		c.flaps[key] = fs
+	}
+	fs.flaps++
+	fs.penalty = math.Min(c.decayedPenalty(fs, now)+float64(c.config.FlapPenalty),
+		float64(maxPenaltyMultiple*c.config.SuppressThreshold))
+	fs.updated = now
+	if !fs.suppressed && fs.penalty >= float64(c.config.SuppressThreshold) {
+		fs.suppressed = true
+		log.Warnf("Suppressed flapping link: %d <- %s/%s; flaps: %d", key.ingressPort, key.egressDeviceID, key.egressPortID, fs.flaps)
+	}
+	c.updateDampeningInTree(key, fs)
+}
+
+// Releases suppressed links whose penalty decayed below the reuse threshold, publishing those presently discovered,
+// and forgets flap history that is no longer relevant; must be called with lock held
+func (c *Controller) reuseLinks() {
+	now := c.now()
+	for key, fs := range c.flaps {
+		penalty := c.decayedPenalty(fs, now)
+		disabled := c.config.FlapPenalty <= 0
+		if fs.suppressed && (disabled || penalty < float64(c.config.ReuseThreshold)) {
+			fs.suppressed = false
+			log.Infof("Released suppressed link: %d <- %s/%s", key.ingressPort, key.egressDeviceID, key.egressPortID)
+			if link, ok := c.links[key]; ok {
+				c.addLinkToTree(link)
+			}
+			c.updateDampeningInTree(key, fs)
+		}
+		if !fs.suppressed && (disabled || penalty < float64(c.config.ReuseThreshold)/2) {
+			delete(c.flaps, key)
+			c.deleteFromTree(dampeningPath(key))
+		}
+	}
+}
+
+// Returns the config tree path of the dampening diagnostics of the given link; links on a VLAN are keyed by their VLAN
+// as well
+func dampeningPath(key linkKey) string {
+	if key.vlan != "" {
+		return fmt.Sprintf("state/link-dampening[port=%d,device=%s,egress-port=%s,vlan=%s]",
+			key.ingressPort, escapeKey(key.egressDeviceID), escapeKey(key.egressPortID), key.vlan)
+	}
+	return fmt.Sprintf("state/link-dampening[port=%d,device=%s,egress-port=%s]",
+		key.ingressPort, escapeKey(key.egressDeviceID), escapeKey(key.egressPortID))
+}
+
+// Publishes the flap history of the given link
+func (c *Controller) updateDampeningInTree(key linkKey, fs *flapState) {
+	path := dampeningPath(key)
+	c.updateTree(
+		treeLeaf{path + "/flaps", intVal(fs.flaps)},
+		treeLeaf{path + "/penalty", intVal(int64(fs.penalty))},
+		treeLeaf{path + "/suppressed", boolVal(fs.suppressed)},
+		treeLeaf{path + "/last-flap", uintVal(uint64(fs.updated.UnixNano()))},
+	)
+}
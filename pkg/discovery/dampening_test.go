@@ -0,0 +1,139 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const flappingLinkPath = "state/link[port=1,device=foo,egress-port=10]"
+const flappingDampeningPath = "state/link-dampening[port=1,device=foo,egress-port=10]"
+
+// Withdraws and re-discovers the test link
+func flapLink(c *Controller) {
+	c.lock.Lock()
+	c.withdrawLink(linkKey{ingressPort: 1, egressDeviceID: "foo", egressPortID: "10"})
+	c.lock.Unlock()
+	c.updateIngressLink(1, "10", "foo", "")
+}
+
+func TestController_FlapDampening(t *testing.T) {
+	c, clock := newTestController(t)
+	c.config.MaxLinkAge = 0
+	c.updateIngressLink(1, "10", "foo", "")
+
+	// First flap only penalizes the link
+	flapLink(c)
+	assert.Len(t, c.GetLinks(), 1)
+	assert.NotNil(t, c.Root().GetPath(flappingLinkPath))
+	assert.Equal(t, int64(1), c.Root().GetPath(flappingDampeningPath+"/flaps").Value().GetIntVal())
+	assert.False(t, c.Root().GetPath(flappingDampeningPath+"/suppressed").Value().GetBoolVal())
+
+	// Second flap in quick succession suppresses it, while still tracking it
+	responder := &testResponder{}
+	c.AddSubscribeResponder(responder)
+	flapLink(c)
+	c.RemoveSubscribeResponder(responder)
+	assert.Len(t, c.GetLinks(), 0)
+	assert.Len(t, c.links, 1)
+	assert.Nil(t, c.Root().GetPath(flappingLinkPath))
+	assert.Equal(t, int64(2), c.Root().GetPath(flappingDampeningPath+"/flaps").Value().GetIntVal())
+	assert.True(t, c.Root().GetPath(flappingDampeningPath+"/suppressed").Value().GetBoolVal())
+	for _, resp := range responder.responses {
+		for _, update := range resp.GetUpdate().Update {
+			assert.NotEqual(t, "link", update.Path.Elem[1].Name)
+		}
+	}
+
+	// Further flaps of a suppressed link should not produce any link notifications
+	responder = &testResponder{}
+	c.AddSubscribeResponder(responder)
+	flapLink(c)
+	c.RemoveSubscribeResponder(responder)
+	for _, resp := range responder.responses {
+		assert.Len(t, resp.GetUpdate().Delete, 0)
+		for _, update := range resp.GetUpdate().Update {
+			assert.NotEqual(t, "link", update.Path.Elem[1].Name)
+		}
+	}
+
+	// Link should remain suppressed until its penalty decays below the reuse threshold
+	clock.advance(60 * time.Second)
+	c.pruneLinks()
+	assert.Len(t, c.GetLinks(), 0)
+
+	clock.advance(61 * time.Second)
+	c.pruneLinks()
+	assert.Len(t, c.GetLinks(), 1)
+	assert.NotNil(t, c.Root().GetPath(flappingLinkPath))
+	assert.False(t, c.Root().GetPath(flappingDampeningPath+"/suppressed").Value().GetBoolVal())
+
+	// Flap history should be forgotten once the penalty decays sufficiently
+	clock.advance(120 * time.Second)
+	c.pruneLinks()
+	assert.Len(t, c.flaps, 0)
+	assert.Nil(t, c.Root().GetPath(flappingDampeningPath))
+}
+
+func TestController_FlapDampeningVLANs(t *testing.T) {
+	c, _ := newTestController(t)
+	c.config.MaxLinkAge = 0
+	tagged := linkKey{ingressPort: 1, egressDeviceID: "foo", egressPortID: "10", vlan: "100"}
+	c.updateIngressLink(1, "10", "foo", "")
+	c.updateIngressLink(1, "10", "foo", "100")
+
+	// Flaps of the link on a VLAN are tracked apart from those of the untagged link to the same neighbor
+	flapLink(c)
+	flapLink(c)
+	c.lock.Lock()
+	c.withdrawLink(tagged)
+	c.lock.Unlock()
+	c.updateIngressLink(1, "10", "foo", "100")
+	assert.True(t, c.Root().GetPath(flappingDampeningPath+"/suppressed").Value().GetBoolVal())
+	taggedPath := "state/link-dampening[port=1,device=foo,egress-port=10,vlan=100]"
+	assert.Equal(t, int64(1), c.Root().GetPath(taggedPath+"/flaps").Value().GetIntVal())
+	assert.False(t, c.Root().GetPath(taggedPath+"/suppressed").Value().GetBoolVal())
+	assert.Len(t, c.GetLinks(), 1)
+
+	// Disabling dampening should release the suppressed link and remove the history of both
+	c.config.FlapPenalty = 0
+	c.pruneLinks()
+	assert.Nil(t, c.Root().GetPath(flappingDampeningPath))
+	assert.Nil(t, c.Root().GetPath(taggedPath))
+	assert.Len(t, c.GetLinks(), 2)
+}
+
+func TestController_FlapDampeningDisabled(t *testing.T) {
+	c, _ := newTestController(t)
+	c.config.MaxLinkAge = 0
+	c.updateIngressLink(1, "10", "foo", "")
+	flapLink(c)
+	flapLink(c)
+	assert.Len(t, c.GetLinks(), 0)
+
+	// Disabling dampening should release suppressed links right away
+	c.config.FlapPenalty = 0
+	c.pruneLinks()
+	assert.Len(t, c.GetLinks(), 1)
+	assert.NotNil(t, c.Root().GetPath(flappingLinkPath))
+	assert.Len(t, c.flaps, 0)
+
+	flapLink(c)
+	flapLink(c)
+	flapLink(c)
+	assert.Len(t, c.GetLinks(), 1)
+	assert.Nil(t, c.Root().GetPath(flappingDampeningPath))
+}
+
+func TestController_PortDownWithdrawsLinks(t *testing.T) {
+	c, _ := newTestController(t)
+	c.ports["1/1"] = &Port{ID: "1/1", Number: 1, Status: portUp}
+	c.updateIngressLink(1, "10", "foo", "")
+	c.processPortStatusUpdate("1/1", portDown)
+	assert.Len(t, c.GetLinks(), 0)
+	assert.Equal(t, int64(1), c.Root().GetPath(flappingDampeningPath+"/flaps").Value().GetIntVal())
+}
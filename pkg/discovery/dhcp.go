@@ -0,0 +1,220 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"encoding/binary"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/openconfig/gnmi/proto/gnmi"
+	"math"
+	"net"
+	"time"
+)
+
+const (
+	dhcpServerPort uint16 = 67
+	dhcpClientPort uint16 = 68
+
+	// Lease time that denotes an infinite lease
+	dhcpInfiniteLease = math.MaxUint32
+
+	// Time for which the port of a client that requested a lease is retained, awaiting acknowledgement of the lease
+	dhcpClientRetention = time.Minute
+)
+
+// DHCPLease represents the DHCP lease of a host, as snooped from the acknowledgement by its server
+type DHCPLease struct {
+	Address  string
+	Server   string
+	Duration time.Duration
+	Expiry   time.Time // zero for infinite lease
+}
+
+// Port of a client that requested a lease
+type dhcpClient struct {
+	port      uint32
+	vlan      string
+	updatedAt time.Time
+}
+
+// Returns true if the two leases are the same
+func (l *DHCPLease) equal(other *DHCPLease) bool {
+	return other != nil && l.Address == other.Address && l.Server == other.Server &&
+		l.Duration == other.Duration && l.Expiry.Equal(other.Expiry)
+}
+
+// Returns true if hosts are to be learned by snooping on DHCP
+func (c *Controller) snoopsDHCP() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.config.DHCPSnooping
+}
+
+// Returns the data of the given option of the given DHCP packet; nil if there is no such option
+func dhcpOption(dhcp *layers.DHCPv4, optionType layers.DHCPOpt) []byte {
+	for _, option := range dhcp.Options {
+		if option.Type == optionType {
+			return option.Data
+		}
+	}
+	return nil
+}
+
+// Learns the port of the client requesting a lease, or the host binding acknowledged by the server, or releases the
+// lease of the host, per the DHCP packet received on the given port
+func (c *Controller) processDHCPPacket(ingressPort uint32, rawPacket gopacket.Packet) {
+	dhcpLayer := rawPacket.Layer(layers.LayerTypeDHCPv4)
+	if dhcpLayer == nil || !c.snoopsDHCP() {
+		return
+	}
+	dhcp := dhcpLayer.(*layers.DHCPv4)
+	msgType := dhcpOption(dhcp, layers.DHCPOptMessageType)
+	if len(msgType) != 1 {
+		return
+	}
+	key := hostKey{mac: dhcp.ClientHWAddr.String(), vlan: packetVLAN(rawPacket)}
+
+	switch layers.DHCPMsgType(msgType[0]) {
+	case layers.DHCPMsgTypeDiscover, layers.DHCPMsgTypeRequest:
+		// Only requests received from the client itself, rather than via a relay agent, reveal its port
+		if dhcp.RelayAgentIP == nil || dhcp.RelayAgentIP.IsUnspecified() {
+			c.lock.Lock()
+			c.dhcpClients[key.mac] = &dhcpClient{port: ingressPort, vlan: key.vlan, updatedAt: c.now()}
+			c.lock.Unlock()
+		}
+	case layers.DHCPMsgTypeAck:
+		c.processDHCPAck(key, dhcp)
+	case layers.DHCPMsgTypeRelease:
+		c.releaseHostLease(key, dhcp.ClientIP.String())
+	}
+}
+
+// Learns the host binding acknowledged by the given DHCP packet, placing the host on the port and VLAN on which it
+// requested the lease, or on which it has been discovered already
+func (c *Controller) processDHCPAck(key hostKey, dhcp *layers.DHCPv4) {
+	leaseTime := dhcpOption(dhcp, layers.DHCPOptLeaseTime)
+	if dhcp.YourClientIP == nil || dhcp.YourClientIP.IsUnspecified() || len(leaseTime) != 4 {
+		return
+	}
+
+	c.lock.RLock()
+	var port uint32
+	if client, ok := c.dhcpClients[key.mac]; ok {
+		port, key.vlan = client.port, client.vlan
+	} else if host := c.findHostByMAC(key.mac); host != nil {
+		// Acknowledgement may arrive on the VLAN of the server, rather than that of the client
+		port, key.vlan = host.Port, host.VLAN
+	}
+	c.lock.RUnlock()
+	if port == 0 {
+		log.Infof("Ignoring DHCP acknowledgement for client %s on unknown port", key.mac)
+		return
+	}
+
+	seconds := binary.BigEndian.Uint32(leaseTime)
+	lease := &DHCPLease{Address: dhcp.YourClientIP.String(), Duration: time.Duration(seconds) * time.Second}
+	if seconds != dhcpInfiniteLease {
+		lease.Expiry = c.now().Add(lease.Duration)
+	}
+	if server := dhcpOption(dhcp, layers.DHCPOptServerID); len(server) == net.IPv4len {
+		lease.Server = net.IP(server).String()
+	}
+	c.learnHost(key, lease.Address, port, dhcpSource)
+	c.updateHostLease(key, lease)
+}
+
+// Returns the host with the given MAC, regardless of its VLAN, or nil if there is none; of hosts with the same MAC on
+// several VLANs, the most recently updated one is returned; must be called with lock held
+func (c *Controller) findHostByMAC(mac string) *Host {
+	var found *Host
+	for key, host := range c.hosts {
+		if key.mac == mac && (found == nil || host.LastUpdate.After(found.LastUpdate)) {
+			found = host
+		}
+	}
+	return found
+}
+
+// Updates the lease of the given host, publishing the change; host whose lease is for a different address is
+// considered to have been renumbered, and its previously leased address is removed
+func (c *Controller) updateHostLease(key hostKey, lease *DHCPLease) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.dhcpClients, key.mac)
+	host, ok := c.hosts[key]
+	if !ok || lease.equal(host.Lease) {
+		return
+	}
+	if host.Lease != nil && host.Lease.Address != lease.Address {
+		c.deleteHostAddress(host, host.Lease.Address)
+	}
+	host.Lease = lease
+
+	expiry := uint64(0)
+	if !lease.Expiry.IsZero() {
+		expiry = uint64(lease.Expiry.UnixNano())
+	}
+	path := hostPath(key) + "/dhcp/"
+	c.updateTree(
+		treeLeaf{path + "address", stringVal(lease.Address)},
+		treeLeaf{path + "server", stringVal(lease.Server)},
+		treeLeaf{path + "lease-time", intVal(int64(lease.Duration / time.Second))},
+		treeLeaf{path + "lease-expiry", uintVal(expiry)})
+}
+
+// Releases the lease of the given address of the given host, removing the host if it has no other addresses
+func (c *Controller) releaseHostLease(key hostKey, ip string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	host, ok := c.hosts[key]
+	if !ok || host.Lease == nil || host.Lease.Address != ip {
+		return
+	}
+	c.deleteHostLease(host)
+	log.Infof("Released host lease: %s <- %s/%d", host.MAC, ip, host.Port)
+	if len(host.IPs) == 0 {
+		c.deleteHost(key)
+	}
+}
+
+// Removes the lease of the given host, along with the leased address; must be called with lock held
+func (c *Controller) deleteHostLease(host *Host) {
+	address := host.Lease.Address
+	c.forgetHostLease(host)
+	c.deleteHostAddress(host, address)
+}
+
+// Removes the lease info of the given host, retaining the leased address; must be called with lock held
+func (c *Controller) forgetHostLease(host *Host) {
+	host.Lease = nil
+	c.deleteFromTree(hostPath(host.key()) + "/dhcp")
+}
+
+// Forgets the ports of clients whose lease has not been acknowledged in time; must be called with lock held
+func (c *Controller) pruneDHCPClients() {
+	limit := c.now().Add(-dhcpClientRetention)
+	for mac, client := range c.dhcpClients {
+		if client.updatedAt.Before(limit) {
+			delete(c.dhcpClients, mac)
+		}
+	}
+}
+
+// Extracts the given leaf of a host lease published via gNMI
+func setLeaseLeaf(lease *DHCPLease, name string, value *gnmi.TypedValue) {
+	switch name {
+	case "address":
+		lease.Address = value.GetStringVal()
+	case "server":
+		lease.Server = value.GetStringVal()
+	case "lease-time":
+		lease.Duration = time.Duration(value.GetIntVal()) * time.Second
+	case "lease-expiry":
+		if expiry := value.GetUintVal(); expiry > 0 {
+			lease.Expiry = time.Unix(0, int64(expiry))
+		}
+	}
+}
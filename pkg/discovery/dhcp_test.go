@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"encoding/binary"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+// Produces DHCP packet of the given type for the client with the given MAC, carrying the given client addresses and
+// options
+func newDHCPPacket(t *testing.T, msgType layers.DHCPMsgType, mac string, clientIP string, yourIP string,
+	options ...layers.DHCPOption) gopacket.Packet {
+	clientMAC, _ := net.ParseMAC(mac)
+	srcPort, dstPort := layers.UDPPort(dhcpClientPort), layers.UDPPort(dhcpServerPort)
+	if msgType == layers.DHCPMsgTypeAck {
+		srcPort, dstPort = dstPort, srcPort
+	}
+	eth := &layers.Ethernet{
+		SrcMAC:       clientMAC,
+		DstMAC:       net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		SrcIP:    net.IPv4zero,
+		DstIP:    net.IPv4bcast,
+		Protocol: layers.IPProtocolUDP,
+	}
+	udp := &layers.UDP{SrcPort: srcPort, DstPort: dstPort}
+	assert.NoError(t, udp.SetNetworkLayerForChecksum(ip))
+	dhcp := &layers.DHCPv4{
+		Operation:    layers.DHCPOpRequest,
+		HardwareType: layers.LinkTypeEthernet,
+		ClientHWAddr: clientMAC,
+		ClientIP:     net.ParseIP(clientIP),
+		YourClientIP: net.ParseIP(yourIP),
+		Options:      append([]layers.DHCPOption{layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(msgType)})}, options...),
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	assert.NoError(t, gopacket.SerializeLayers(buf, opts, eth, ip, udp, dhcp))
+	return gopacket.NewPacket(buf.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+}
+
+// Produces DHCP acknowledgement of the given address for the client with the given MAC, with the given lease time
+func newDHCPAck(t *testing.T, mac string, ip string, leaseTime uint32) gopacket.Packet {
+	return newDHCPPacket(t, layers.DHCPMsgTypeAck, mac, "0.0.0.0", ip,
+		layers.NewDHCPOption(layers.DHCPOptLeaseTime, binary.BigEndian.AppendUint32(nil, leaseTime)),
+		layers.NewDHCPOption(layers.DHCPOptServerID, net.ParseIP("10.0.0.254").To4()))
+}
+
+func TestController_DHCPSnooping(t *testing.T) {
+	c, clock := newTestController(t)
+	c.config.MaxHostAge = 60
+	mac := "00:00:00:00:00:01"
+	request := newDHCPPacket(t, layers.DHCPMsgTypeRequest, mac, "0.0.0.0", "0.0.0.0")
+
+	// Nothing is learned unless snooping is enabled
+	c.processDHCPPacket(3, request)
+	c.processDHCPPacket(1, newDHCPAck(t, mac, "10.0.0.1", 120))
+	assert.Len(t, c.hosts, 0)
+
+	// Acknowledgement places the host on the port of its request, rather than the port of the server
+	c.config.DHCPSnooping = true
+	c.processDHCPPacket(1, newDHCPAck(t, mac, "10.0.0.1", 120))
+	assert.Len(t, c.hosts, 0)
+	c.processDHCPPacket(3, request)
+	c.processDHCPPacket(1, newDHCPAck(t, mac, "10.0.0.1", 120))
+	assert.Len(t, c.hosts, 1)
+	host := c.hosts[hostKey{mac: mac}]
+	assert.Equal(t, uint32(3), host.Port)
+	assert.Equal(t, []string{"10.0.0.1"}, host.IPs)
+	assert.Equal(t, &DHCPLease{Address: "10.0.0.1", Server: "10.0.0.254", Duration: 120 * time.Second,
+		Expiry: clock.now().Add(120 * time.Second)}, host.Lease)
+	assert.Equal(t, int64(120), c.Root().GetPath("state/host[mac=00:00:00:00:00:01]/dhcp/lease-time").Value().GetIntVal())
+	assert.Equal(t, "10.0.0.254", c.Root().GetPath("state/host[mac=00:00:00:00:00:01]/dhcp/server").Value().GetStringVal())
+
+	// Leased host outlives the max host age, until its lease expires
+	clock.advance(90 * time.Second)
+	c.pruneHosts()
+	assert.Len(t, c.hosts, 1)
+	clock.advance(40 * time.Second)
+	c.pruneHosts()
+	assert.Len(t, c.hosts, 0)
+
+	// Renewal of a host already discovered needs no request, and release removes the host
+	c.updateHost(hostKey{mac: mac}, "10.0.0.1", 4)
+	c.processDHCPPacket(1, newDHCPAck(t, mac, "10.0.0.2", 120))
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, c.hosts[hostKey{mac: mac}].IPs)
+	assert.Equal(t, uint32(4), c.hosts[hostKey{mac: mac}].Port)
+	c.processDHCPPacket(4, newDHCPPacket(t, layers.DHCPMsgTypeRelease, mac, "10.0.0.2", "0.0.0.0"))
+	assert.Equal(t, []string{"10.0.0.1"}, c.hosts[hostKey{mac: mac}].IPs)
+	assert.Nil(t, c.hosts[hostKey{mac: mac}].Lease)
+	assert.Nil(t, c.Root().GetPath("state/host[mac=00:00:00:00:00:01]/dhcp/address"))
+}
+
+func TestController_DHCPAckOnServerVLAN(t *testing.T) {
+	c, _ := newTestController(t)
+	c.config.DHCPSnooping = true
+	mac := "00:00:00:00:00:01"
+
+	// Renewal acknowledged on another VLAN than that of the client applies to the host already discovered
+	c.updateHost(hostKey{mac: mac, vlan: "100"}, "10.0.0.1", 4)
+	c.processDHCPPacket(1, newDHCPAck(t, mac, "10.0.0.1", 120))
+	assert.Len(t, c.hosts, 1)
+	host := c.hosts[hostKey{mac: mac, vlan: "100"}]
+	assert.Equal(t, uint32(4), host.Port)
+	assert.Equal(t, "10.0.0.1", host.Lease.Address)
+}
@@ -0,0 +1,117 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"net"
+	"strings"
+)
+
+// Auxiliary structure for efficient matching of ports and hosts against the configured exclusions
+type exclusions struct {
+	ports       map[uint32]bool
+	hosts       map[string]bool
+	macPrefixes []string
+	ipPrefixes  []*net.IPNet
+}
+
+// Creates exclusions from the given configuration; malformed IP prefixes are ignored with a warning
+func newExclusions(config *Config) *exclusions {
+	e := &exclusions{
+		ports: make(map[uint32]bool),
+		hosts: make(map[string]bool),
+	}
+	for _, port := range config.ExcludedPorts {
+		e.ports[port] = true
+	}
+	for _, mac := range config.ExcludedHosts {
+		e.hosts[strings.ToLower(mac)] = true
+	}
+	for _, prefix := range config.ExcludedMACPrefixes {
+		e.macPrefixes = append(e.macPrefixes, strings.ToLower(prefix))
+	}
+	for _, prefix := range config.ExcludedIPPrefixes {
+		if !strings.Contains(prefix, "/") {
+			if ip := net.ParseIP(prefix); ip != nil && ip.To4() != nil {
+				prefix = prefix + "/32"
+			} else {
+				prefix = prefix + "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(prefix)
+		if err != nil {
+			log.Warnf("Ignoring malformed IP prefix exclusion %s: %+v", prefix, err)
+			continue
+		}
+		e.ipPrefixes = append(e.ipPrefixes, ipNet)
+	}
+	return e
+}
+
+// Returns true if the given port is excluded
+func (e *exclusions) isPortExcluded(port uint32) bool {
+	return e.ports[port]
+}
+
+// Returns true if the host with the given MAC and IP, discovered on the given port, is excluded
+func (e *exclusions) isHostExcluded(mac string, ip string, port uint32) bool {
+	mac = strings.ToLower(mac)
+	if e.ports[port] || e.hosts[mac] {
+		return true
+	}
+	for _, prefix := range e.macPrefixes {
+		if strings.HasPrefix(mac, prefix) {
+			return true
+		}
+	}
+	if addr := net.ParseIP(ip); addr != nil {
+		for _, prefix := range e.ipPrefixes {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns true if the given port is presently excluded
+func (c *Controller) isPortExcluded(port uint32) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.exclusions.isPortExcluded(port)
+}
+
+// Removes any links and hosts that match the current exclusions; must be called with lock held
+func (c *Controller) pruneExcluded() {
+	for key, link := range c.links {
+		if c.exclusions.isPortExcluded(key.ingressPort) {
+			c.deleteLink(key)
+			log.Infof("Removed excluded link: %d <- %s/%s", link.IngressPort, link.EgressDeviceID, link.EgressPortID)
+		}
+	}
+	for key, host := range c.hosts {
+		for _, ip := range host.IPs {
+			if c.exclusions.isHostExcluded(host.MAC, ip, host.Port) {
+				c.deleteHostAddress(host, ip)
+				log.Infof("Removed excluded host address: %s <- %s/%d", host.MAC, ip, host.Port)
+			}
+		}
+		if len(host.IPs) == 0 {
+			c.deleteHost(key)
+			log.Infof("Removed excluded host: %s <- %d", host.MAC, host.Port)
+		}
+	}
+}
+
+// Splits the given comma-separated list, dropping any empty items
+func splitList(list string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
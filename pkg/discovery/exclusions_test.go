@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"github.com/openconfig/gnmi/proto/gnmi"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestExclusions(t *testing.T) {
+	e := newExclusions(&Config{
+		ExcludedPorts:       []uint32{7},
+		ExcludedHosts:       []string{"AA:BB:CC:DD:EE:FF"},
+		ExcludedMACPrefixes: []string{"00:60:08"},
+		ExcludedIPPrefixes:  []string{"10.1.0.0/16", "192.168.1.1", "fd00::/8", "bogus/99"},
+	})
+
+	assert.True(t, e.isPortExcluded(7))
+	assert.False(t, e.isPortExcluded(8))
+
+	assert.True(t, e.isHostExcluded("00:00:00:00:00:01", "10.0.0.1", 7))
+	assert.True(t, e.isHostExcluded("aa:bb:cc:dd:ee:ff", "10.0.0.1", 1))
+	assert.True(t, e.isHostExcluded("00:60:08:01:02:03", "10.0.0.1", 1))
+	assert.True(t, e.isHostExcluded("00:00:00:00:00:01", "10.1.2.3", 1))
+	assert.True(t, e.isHostExcluded("00:00:00:00:00:01", "192.168.1.1", 1))
+	assert.True(t, e.isHostExcluded("00:00:00:00:00:01", "fd00::1", 1))
+	assert.False(t, e.isHostExcluded("00:00:00:00:00:01", "192.168.1.2", 1))
+	assert.False(t, e.isHostExcluded("00:00:00:00:00:01", "10.0.0.1", 1))
+}
+
+func TestController_ExclusionsViaConfig(t *testing.T) {
+	c, _ := newTestController(t)
+
+	c.updateIngressLink(1, "10", "foo", "")
+	c.updateIngressLink(2, "20", "bar", "")
+	c.updateHost(hostKey{mac: "00:00:00:00:00:01"}, "10.0.0.1", 3)
+	c.updateHost(hostKey{mac: "00:60:08:00:00:02"}, "10.0.0.2", 4)
+	c.updateHost(hostKey{mac: "00:00:00:00:00:03"}, "10.2.0.3", 4)
+
+	// Exclude port 2, host 1, the SONiC MAC prefix and a subnet
+	c.Root().AddPath("config/exclude-port[number=2]", &gnmi.TypedValue{Value: &gnmi.TypedValue_BoolVal{BoolVal: true}})
+	c.Root().AddPath("config/exclude-host[mac=00:00:00:00:00:01]", &gnmi.TypedValue{Value: &gnmi.TypedValue_BoolVal{BoolVal: true}})
+	c.Root().AddPath("config/exclude-mac-prefixes", &gnmi.TypedValue{Value: &gnmi.TypedValue_StringVal{StringVal: "00:60:08"}})
+	c.Root().AddPath("config/exclude-ip-prefixes", &gnmi.TypedValue{Value: &gnmi.TypedValue_StringVal{StringVal: "10.2.0.0/16, "}})
+	c.UpdateConfig()
+
+	assert.Equal(t, []uint32{2}, c.config.ExcludedPorts)
+	assert.Equal(t, []string{"10.2.0.0/16"}, c.config.ExcludedIPPrefixes)
+	links := c.GetLinks()
+	assert.Len(t, links, 1)
+	assert.Equal(t, uint32(1), links[0].IngressPort)
+	assert.Nil(t, c.Root().GetPath("state/link[port=2,device=bar,egress-port=20]"))
+	assert.Len(t, c.hosts, 0)
+
+	// Newly discovered links and hosts should be excluded as well
+	c.updateIngressLink(2, "20", "bar", "")
+	c.updateHost(hostKey{mac: "00:00:00:00:00:01"}, "10.0.0.1", 3)
+	assert.Len(t, c.GetLinks(), 1)
+	assert.Len(t, c.hosts, 0)
+
+	// Exclusions should be persisted
+	config := loadConfig()
+	assert.Equal(t, []uint32{2}, config.ExcludedPorts)
+	assert.Equal(t, []string{"00:00:00:00:00:01"}, config.ExcludedHosts)
+	assert.Equal(t, []string{"00:60:08"}, config.ExcludedMACPrefixes)
+
+	// Removing exclusion should allow the link to be discovered again
+	c.Root().DeletePath("config/exclude-port[number=2]")
+	c.UpdateConfig()
+	c.updateIngressLink(2, "20", "bar", "")
+	assert.Len(t, c.GetLinks(), 2)
+}
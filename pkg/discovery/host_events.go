@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"fmt"
+	"github.com/google/gopacket/layers"
+	"github.com/onosproject/onos-net-lib/pkg/packet"
+	"net"
+)
+
+const (
+	// Classes of ARP packets, also used as sources of host events
+	arpRequest    = "arp-request"
+	arpReply      = "arp-reply"
+	arpGratuitous = "gratuitous-arp"
+	arpProbe      = "arp-probe"
+
+	// Sources of host events learned from other than ARP packets
+	ndpSource  = "ndp"
+	dhcpSource = "dhcp"
+
+	// Types of host events
+	hostMoved  = "host-move"
+	ipConflict = "ip-conflict"
+
+	// Maximum number of host events retained in the config tree
+	maxHostEventHistory = 64
+)
+
+// Classifies the given ARP packet as a request, reply, gratuitous ARP, i.e. an announcement of the sender's own
+// address, or as a probe, i.e. a request from the unspecified address checking whether the target address is in use
+func classifyARP(arp *layers.ARP) string {
+	sender, target := net.IP(arp.SourceProtAddress), net.IP(arp.DstProtAddress)
+	switch {
+	case arp.Operation == layers.ARPRequest && sender.IsUnspecified():
+		return arpProbe
+	case sender.Equal(target):
+		return arpGratuitous
+	case arp.Operation == layers.ARPReply:
+		return arpReply
+	default:
+		return arpRequest
+	}
+}
+
+// Learns the sender of the given ARP packet received on the given port and VLAN; probes are not learned, as their
+// sender does not hold any address yet
+func (c *Controller) processARPPacket(ingressPort uint32, vlan string, arp *layers.ARP) {
+	class := classifyARP(arp)
+	if class == arpProbe {
+		return
+	}
+	key := hostKey{mac: packet.MACString(arp.SourceHwAddress), vlan: vlan}
+	c.learnHost(key, packet.IPString(arp.SourceProtAddress), ingressPort, class)
+}
+
+// Records the move of the given host from the given port to its present one; must be called with lock held
+func (c *Controller) recordHostMove(host *Host, fromPort uint32, ipString string, source string) {
+	host.Moves++
+	log.Warnf("Host %s moved from port %d to port %d (%s)", host.MAC, fromPort, host.Port, source)
+	c.updateTree(treeLeaf{hostPath(host.key()) + "/moves", intVal(int64(host.Moves))})
+	c.recordHostEvent(hostMoved, source, host.VLAN,
+		treeLeaf{"mac", stringVal(host.MAC)},
+		treeLeaf{"ip", stringVal(ipString)},
+		treeLeaf{"port", intVal(int64(host.Port))},
+		treeLeaf{"previous-port", intVal(int64(fromPort))},
+	)
+}
+
+// Records conflicts of the given address newly learned for the given host with any other hosts on the same VLAN
+// holding the same address; must be called with lock held
+func (c *Controller) detectIPConflicts(host *Host, ipString string, source string) {
+	for key, other := range c.hosts {
+		if key.mac == host.MAC || key.vlan != host.VLAN {
+			continue
+		}
+		if _, ok := other.addresses[ipString]; !ok {
+			continue
+		}
+		log.Warnf("Address %s claimed by host %s on port %d is held by host %s on port %d%s (%s)",
+			ipString, host.MAC, host.Port, key.mac, other.Port, vlanSuffix(key.vlan), source)
+		c.recordHostEvent(ipConflict, source, host.VLAN,
+			treeLeaf{"mac", stringVal(host.MAC)},
+			treeLeaf{"ip", stringVal(ipString)},
+			treeLeaf{"port", intVal(int64(host.Port))},
+			treeLeaf{"conflicting-mac", stringVal(key.mac)},
+			treeLeaf{"conflicting-port", intVal(int64(other.Port))},
+		)
+	}
+}
+
+// Records the host event of the given type on the given VLAN, with the given details, in the config tree, retaining
+// only a limited history of events, and forwards it to any subscribe responders; must be called with lock held
+func (c *Controller) recordHostEvent(eventType string, source string, vlan string, details ...treeLeaf) {
+	c.hostEventSeq++
+	prefix := fmt.Sprintf("state/host-events/event[seq=%d]/", c.hostEventSeq)
+	leaves := []treeLeaf{
+		{prefix + "type", stringVal(eventType)},
+		{prefix + "source", stringVal(source)},
+		{prefix + "time", uintVal(uint64(c.now().UnixNano()))},
+	}
+	if vlan != "" {
+		leaves = append(leaves, treeLeaf{prefix + "vlan", stringVal(vlan)})
+	}
+	for _, detail := range details {
+		leaves = append(leaves, treeLeaf{prefix + detail.path, detail.value})
+	}
+	c.updateTree(leaves...)
+	if c.hostEventSeq > maxHostEventHistory {
+		c.deleteFromTree(fmt.Sprintf("state/host-events/event[seq=%d]", c.hostEventSeq-maxHostEventHistory))
+	}
+}
@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"fmt"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+// Produces ARP packet of the given operation from the given MAC and address, for the given target address
+func newARP(operation uint16, mac string, ip string, target string) *layers.ARP {
+	srcMAC, _ := net.ParseMAC(mac)
+	return &layers.ARP{
+		AddrType:          layers.LinkTypeEthernet,
+		Protocol:          layers.EthernetTypeIPv4,
+		Operation:         operation,
+		SourceHwAddress:   srcMAC,
+		SourceProtAddress: net.ParseIP(ip).To4(),
+		DstHwAddress:      make([]byte, 6),
+		DstProtAddress:    net.ParseIP(target).To4(),
+	}
+}
+
+func TestClassifyARP(t *testing.T) {
+	mac := "00:00:00:00:00:01"
+	assert.Equal(t, arpRequest, classifyARP(newARP(layers.ARPRequest, mac, "10.0.0.1", "10.0.0.2")))
+	assert.Equal(t, arpReply, classifyARP(newARP(layers.ARPReply, mac, "10.0.0.1", "10.0.0.2")))
+	assert.Equal(t, arpGratuitous, classifyARP(newARP(layers.ARPRequest, mac, "10.0.0.1", "10.0.0.1")))
+	assert.Equal(t, arpGratuitous, classifyARP(newARP(layers.ARPReply, mac, "10.0.0.1", "10.0.0.1")))
+	assert.Equal(t, arpProbe, classifyARP(newARP(layers.ARPRequest, mac, "0.0.0.0", "10.0.0.1")))
+}
+
+func TestController_HostEvents(t *testing.T) {
+	c, _ := newTestController(t)
+	mac, otherMAC := "00:00:00:00:00:01", "00:00:00:00:00:02"
+	event := func(seq int, leaf string) string {
+		return c.Root().GetPath(fmt.Sprintf("state/host-events/event[seq=%d]/%s", seq, leaf)).Value().GetStringVal()
+	}
+
+	// Probes are not learned
+	c.processARPPacket(3, "", newARP(layers.ARPRequest, mac, "0.0.0.0", "10.0.0.1"))
+	assert.Len(t, c.hosts, 0)
+
+	c.processARPPacket(3, "", newARP(layers.ARPRequest, mac, "10.0.0.1", "10.0.0.9"))
+	assert.Len(t, c.hosts, 1)
+	assert.Nil(t, c.Root().GetPath("state/host-events/event[seq=1]"))
+
+	// Gratuitous ARP on another port records the move
+	c.processARPPacket(4, "", newARP(layers.ARPRequest, mac, "10.0.0.1", "10.0.0.1"))
+	assert.Equal(t, uint32(4), c.hosts[hostKey{mac: mac}].Port)
+	assert.Equal(t, 1, c.hosts[hostKey{mac: mac}].Moves)
+	assert.Equal(t, int64(1), c.Root().GetPath("state/host[mac=00:00:00:00:00:01]/moves").Value().GetIntVal())
+	assert.Equal(t, hostMoved, event(1, "type"))
+	assert.Equal(t, arpGratuitous, event(1, "source"))
+	assert.Equal(t, mac, event(1, "mac"))
+	assert.Equal(t, int64(3), c.Root().GetPath("state/host-events/event[seq=1]/previous-port").Value().GetIntVal())
+	assert.Equal(t, int64(4), c.Root().GetPath("state/host-events/event[seq=1]/port").Value().GetIntVal())
+
+	// The same address claimed by another host records the conflict, retaining both bindings
+	c.processARPPacket(5, "", newARP(layers.ARPReply, otherMAC, "10.0.0.1", "10.0.0.9"))
+	assert.Len(t, c.hosts, 2)
+	assert.Equal(t, ipConflict, event(2, "type"))
+	assert.Equal(t, arpReply, event(2, "source"))
+	assert.Equal(t, otherMAC, event(2, "mac"))
+	assert.Equal(t, "10.0.0.1", event(2, "ip"))
+	assert.Equal(t, mac, event(2, "conflicting-mac"))
+	assert.Equal(t, int64(4), c.Root().GetPath("state/host-events/event[seq=2]/conflicting-port").Value().GetIntVal())
+
+	// Conflicts are recorded only when the address is newly claimed
+	c.processARPPacket(5, "", newARP(layers.ARPReply, otherMAC, "10.0.0.1", "10.0.0.9"))
+	assert.Nil(t, c.Root().GetPath("state/host-events/event[seq=3]"))
+
+	// Mirrored hosts record no events
+	c.updateHost(hostKey{mac: mac}, "10.0.0.1", 6)
+	assert.Equal(t, uint32(6), c.hosts[hostKey{mac: mac}].Port)
+	assert.Nil(t, c.Root().GetPath("state/host-events/event[seq=3]"))
+
+	// Only a limited history of events is retained
+	for i := 0; i < maxHostEventHistory; i++ {
+		c.learnHost(hostKey{mac: mac}, "10.0.0.8", uint32(7+i%2), arpRequest)
+	}
+	assert.Nil(t, c.Root().GetPath("state/host-events/event[seq=2]"))
+	assert.NotNil(t, c.Root().GetPath("state/host-events/event[seq=3]"))
+}
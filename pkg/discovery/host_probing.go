@@ -0,0 +1,213 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"net"
+	"sort"
+	"time"
+)
+
+// Address of a host, probed to check whether the host is still alive
+type hostAddress struct {
+	host hostKey
+	ip   string
+}
+
+// Auxiliary state for liveness probing of hosts
+type hostProbeState struct {
+	probedAt   map[hostAddress]time.Time
+	tokens     float64
+	refilledAt time.Time
+	sent       int64
+	answered   int64
+}
+
+// Probe due to be sent to the given host address on the given port
+type hostProbe struct {
+	hostAddress
+	port       uint32
+	lastUpdate time.Time
+}
+
+// Probes hosts whose addresses are about to expire, so that hosts still alive refresh them by answering; probes are
+// sent only if the probe window is configured
+func (c *Controller) probeHosts() {
+	for _, probe := range c.dueHostProbes() {
+		payload, err := hostProbePacket(probe.host, probe.ip)
+		if err != nil {
+			log.Warnf("Unable to create probe for host %s/%s: %+v", probe.host.mac, probe.ip, err)
+		} else if err = c.emitPacket(probe.port, payload); err != nil {
+			log.Warnf("Unable to emit probe for host %s/%s: %+v", probe.host.mac, probe.ip, err)
+		}
+	}
+}
+
+// Returns the probes due to be sent, i.e. for addresses not updated for longer than the max host age less the probe
+// window, and not probed within the probe interval; the probes are limited by the probe rate, with the addresses
+// closest to expiry being probed first
+func (c *Controller) dueHostProbes() []*hostProbe {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	window := time.Duration(c.config.HostProbeWindow) * time.Second
+	maxAge := time.Duration(c.config.MaxHostAge) * time.Second
+	if window <= 0 || maxAge <= 0 {
+		return nil
+	}
+
+	now := c.now()
+	c.refillHostProbeTokens(now)
+	limit := now.Add(window - maxAge)
+	retry := now.Add(-time.Duration(c.config.HostProbeInterval) * time.Second)
+	probes := make([]*hostProbe, 0)
+	probedAt := make(map[hostAddress]time.Time)
+	for key, host := range c.hosts {
+		for ip, lastUpdate := range host.addresses {
+			// Leased addresses do not expire per the max host age
+			if host.Lease != nil && host.Lease.Address == ip {
+				continue
+			}
+			// Neighbor solicitations are not sent unless their answers would be learned
+			if !c.config.IPv6HostLearning && net.ParseIP(ip).To4() == nil {
+				continue
+			}
+			address := hostAddress{host: key, ip: ip}
+			if at, ok := c.hostProbes.probedAt[address]; ok && at.After(lastUpdate) {
+				probedAt[address] = at
+				if at.After(retry) {
+					continue
+				}
+			}
+			if lastUpdate.Before(limit) {
+				probes = append(probes, &hostProbe{hostAddress: address, port: host.Port, lastUpdate: lastUpdate})
+			}
+		}
+	}
+	// Probes of addresses that have since been refreshed or removed are forgotten
+	c.hostProbes.probedAt = probedAt
+
+	sort.Slice(probes, func(i, j int) bool { return probes[i].lastUpdate.Before(probes[j].lastUpdate) })
+	if c.config.HostProbeRate > 0 && len(probes) > int(c.hostProbes.tokens) {
+		probes = probes[:int(c.hostProbes.tokens)]
+	}
+	if c.config.HostProbeRate > 0 {
+		c.hostProbes.tokens -= float64(len(probes))
+	}
+	for _, probe := range probes {
+		c.hostProbes.probedAt[probe.hostAddress] = now
+	}
+	if len(probes) > 0 {
+		c.hostProbes.sent += int64(len(probes))
+		c.updateTree(treeLeaf{"state/host-probes/sent", intVal(c.hostProbes.sent)})
+	}
+	return probes
+}
+
+// Replenishes the probes that may be sent at the configured rate; as probes are only sent once per prune period, those
+// due for the whole period are allowed to be sent at once, so the rate holds on average; must be called with lock held
+func (c *Controller) refillHostProbeTokens(now time.Time) {
+	rate := float64(c.config.HostProbeRate)
+	burst := rate * float64(c.config.LinkPruneFrequency)
+	if burst < rate {
+		burst = rate
+	}
+	if c.hostProbes.refilledAt.IsZero() {
+		c.hostProbes.tokens = burst
+	} else {
+		c.hostProbes.tokens += now.Sub(c.hostProbes.refilledAt).Seconds() * rate
+	}
+	if c.hostProbes.tokens > burst {
+		c.hostProbes.tokens = burst
+	}
+	c.hostProbes.refilledAt = now
+}
+
+// Counts the given update of a host address as an answer, if the address has been probed; must be called with lock
+// held
+func (c *Controller) noteHostProbeAnswer(key hostKey, ip string) {
+	address := hostAddress{host: key, ip: ip}
+	if _, ok := c.hostProbes.probedAt[address]; !ok {
+		return
+	}
+	delete(c.hostProbes.probedAt, address)
+	c.hostProbes.answered++
+	c.updateTree(treeLeaf{"state/host-probes/answered", intVal(c.hostProbes.answered)})
+}
+
+// Produces a unicast probe of the given address of the given host, tagged with its VLAN, if any; IPv4 addresses are
+// probed via ARP request from the unspecified address, as the agent has no address of its own, and IPv6 addresses
+// via neighbor solicitation from the link-local address of the agent
+func hostProbePacket(key hostKey, ip string) ([]byte, error) {
+	payload, err := untaggedHostProbePacket(key.mac, ip)
+	if err != nil {
+		return nil, err
+	}
+	vlanIDs, err := parseVLAN(key.vlan)
+	if err != nil {
+		return nil, err
+	}
+	return tagPacket(payload, vlanIDs), nil
+}
+
+// Produces an untagged unicast probe of the given host address
+func untaggedHostProbePacket(mac string, ip string) ([]byte, error) {
+	dstMAC, err := net.ParseMAC(mac)
+	if err != nil {
+		return nil, err
+	}
+	dstIP := net.ParseIP(ip)
+	eth := &layers.Ethernet{SrcMAC: lldpSourceMAC, DstMAC: dstMAC}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if dstIP.To4() != nil {
+		eth.EthernetType = layers.EthernetTypeARP
+		arp := &layers.ARP{
+			AddrType:          layers.LinkTypeEthernet,
+			Protocol:          layers.EthernetTypeIPv4,
+			HwAddressSize:     6,
+			ProtAddressSize:   4,
+			Operation:         layers.ARPRequest,
+			SourceHwAddress:   lldpSourceMAC,
+			SourceProtAddress: net.IPv4zero.To4(),
+			DstHwAddress:      make([]byte, 6),
+			DstProtAddress:    dstIP.To4(),
+		}
+		err = gopacket.SerializeLayers(buf, opts, eth, arp)
+		return buf.Bytes(), err
+	}
+
+	eth.EthernetType = layers.EthernetTypeIPv6
+	ip6 := &layers.IPv6{
+		Version:    6,
+		SrcIP:      linkLocalAddress(lldpSourceMAC),
+		DstIP:      dstIP,
+		NextHeader: layers.IPProtocolICMPv6,
+		HopLimit:   255,
+	}
+	icmp := &layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeNeighborSolicitation, 0)}
+	if err = icmp.SetNetworkLayerForChecksum(ip6); err != nil {
+		return nil, err
+	}
+	ns := &layers.ICMPv6NeighborSolicitation{
+		TargetAddress: dstIP,
+		Options:       layers.ICMPv6Options{{Type: layers.ICMPv6OptSourceAddress, Data: lldpSourceMAC}},
+	}
+	err = gopacket.SerializeLayers(buf, opts, eth, ip6, icmp, ns)
+	return buf.Bytes(), err
+}
+
+// Returns the IPv6 link-local address derived from the given MAC address per modified EUI-64
+func linkLocalAddress(mac net.HardwareAddr) net.IP {
+	ip := make(net.IP, net.IPv6len)
+	ip[0], ip[1] = 0xfe, 0x80
+	copy(ip[8:11], mac[0:3])
+	ip[8] ^= 0x02
+	ip[11], ip[12] = 0xff, 0xfe
+	copy(ip[13:16], mac[3:6])
+	return ip
+}
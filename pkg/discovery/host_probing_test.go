@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestController_HostProbing(t *testing.T) {
+	c, clock := newTestController(t)
+	c.config.MaxHostAge = 60
+	c.config.LinkPruneFrequency = 1
+	c.config.HostProbeInterval = 5
+	c.config.HostProbeRate = 2
+
+	c.updateHost(hostKey{mac: "00:00:00:00:00:01"}, "10.0.0.1", 3)
+	clock.advance(time.Second)
+	c.updateHost(hostKey{mac: "00:00:00:00:00:02"}, "10.0.0.2", 4)
+	clock.advance(time.Second)
+	c.updateHost(hostKey{mac: "00:00:00:00:00:03"}, "10.0.0.3", 5)
+
+	// No probes unless the probe window is configured
+	clock.advance(50 * time.Second)
+	assert.Len(t, c.dueHostProbes(), 0)
+
+	// Addresses closest to expiry are probed first, up to the rate limit
+	c.config.HostProbeWindow = 20
+	probes := c.dueHostProbes()
+	assert.Len(t, probes, 2)
+	assert.Equal(t, "10.0.0.1", probes[0].ip)
+	assert.Equal(t, uint32(3), probes[0].port)
+	assert.Equal(t, "10.0.0.2", probes[1].ip)
+
+	// Remaining addresses are probed as the rate limit permits
+	clock.advance(time.Second)
+	probes = c.dueHostProbes()
+	assert.Len(t, probes, 1)
+	assert.Equal(t, "10.0.0.3", probes[0].ip)
+	assert.Equal(t, int64(3), c.Root().GetPath("state/host-probes/sent").Value().GetIntVal())
+
+	// Addresses are not probed again within the probe interval
+	clock.advance(time.Second)
+	assert.Len(t, c.dueHostProbes(), 0)
+
+	// Answering host refreshes its address and is not probed again
+	c.updateHost(hostKey{mac: "00:00:00:00:00:01"}, "10.0.0.1", 3)
+	assert.Equal(t, int64(1), c.Root().GetPath("state/host-probes/answered").Value().GetIntVal())
+	clock.advance(5 * time.Second)
+	probes = c.dueHostProbes()
+	assert.Len(t, probes, 2)
+	assert.NotEqual(t, "10.0.0.1", probes[0].ip)
+	assert.NotEqual(t, "10.0.0.1", probes[1].ip)
+
+	// Silent hosts still expire
+	clock.advance(10 * time.Second)
+	c.pruneHosts()
+	assert.Len(t, c.hosts, 1)
+}
+
+func TestController_IPv6HostProbing(t *testing.T) {
+	c, clock := newTestController(t)
+	c.config.MaxHostAge = 60
+	c.config.HostProbeWindow = 20
+
+	c.updateHost(hostKey{mac: "00:00:00:00:00:01"}, "10.0.0.1", 3)
+	c.updateHost(hostKey{mac: "00:00:00:00:00:02"}, "2001:db8::2", 4)
+	clock.advance(50 * time.Second)
+
+	// Neighbor solicitations are not sent unless IPv6 hosts are learned
+	c.config.IPv6HostLearning = false
+	probes := c.dueHostProbes()
+	assert.Len(t, probes, 1)
+	assert.Equal(t, "10.0.0.1", probes[0].ip)
+
+	c.config.IPv6HostLearning = true
+	probes = c.dueHostProbes()
+	assert.Len(t, probes, 1)
+	assert.Equal(t, "2001:db8::2", probes[0].ip)
+}
+
+func TestHostProbePacket(t *testing.T) {
+	payload, err := hostProbePacket(hostKey{mac: "00:00:00:00:00:01"}, "10.0.0.1")
+	assert.NoError(t, err)
+	pkt := gopacket.NewPacket(payload, layers.LayerTypeEthernet, gopacket.Default)
+	assert.Equal(t, "00:00:00:00:00:01", pkt.Layer(layers.LayerTypeEthernet).(*layers.Ethernet).DstMAC.String())
+	arp := pkt.Layer(layers.LayerTypeARP).(*layers.ARP)
+	assert.Equal(t, arpProbe, classifyARP(arp))
+	assert.Equal(t, net.ParseIP("10.0.0.1").To4(), net.IP(arp.DstProtAddress))
+
+	payload, err = hostProbePacket(hostKey{mac: "00:00:00:00:00:01"}, "2001:db8::1")
+	assert.NoError(t, err)
+	pkt = gopacket.NewPacket(payload, layers.LayerTypeEthernet, gopacket.Default)
+	assert.Equal(t, "fe80::260:8ff:fe69:97ef", pkt.Layer(layers.LayerTypeIPv6).(*layers.IPv6).SrcIP.String())
+	ns := pkt.Layer(layers.LayerTypeICMPv6NeighborSolicitation).(*layers.ICMPv6NeighborSolicitation)
+	assert.Equal(t, "2001:db8::1", ns.TargetAddress.String())
+}
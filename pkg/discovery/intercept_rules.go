@@ -0,0 +1,304 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/onosproject/onos-lib-go/pkg/errors"
+	"github.com/onosproject/onos-net-lib/pkg/configtree"
+	"github.com/onosproject/onos-net-lib/pkg/gnmiutils"
+	"github.com/onosproject/onos-net-lib/pkg/p4utils"
+	p4info "github.com/p4lang/p4runtime/go/p4/config/v1"
+	p4api "github.com/p4lang/p4runtime/go/p4/v1"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Statuses of intercept rules, as published via the config tree
+	interceptInstalled = "installed"
+	interceptInvalid   = "invalid" // the rule does not resolve against the P4Info
+	interceptFailed    = "failed"  // the rule resolves, but the switch refused it
+)
+
+// InterceptRule declares a rule that sends packets to the CPU, in terms of the names of P4 entities, which are
+// resolved against the P4Info of the pipeline at runtime
+type InterceptRule struct {
+	Name     string           `mapstructure:"name" yaml:"name"`
+	Table    string           `mapstructure:"table" yaml:"table"`
+	Matches  []InterceptMatch `mapstructure:"matches" yaml:"matches"`
+	Action   string           `mapstructure:"action" yaml:"action"`
+	Params   []InterceptParam `mapstructure:"params" yaml:"params"`
+	Priority int32            `mapstructure:"priority" yaml:"priority"`
+}
+
+// InterceptMatch declares a match of an intercept rule; values are given as numbers, decimal or 0x-prefixed
+// hexadecimal, or as MAC or IP addresses; the mask applies to ternary matches, or gives the prefix length of LPM
+// matches, and defaults to all bits of the field being significant
+type InterceptMatch struct {
+	Field string `mapstructure:"field" yaml:"field"`
+	Value string `mapstructure:"value" yaml:"value"`
+	Mask  string `mapstructure:"mask" yaml:"mask"`
+}
+
+// InterceptParam declares a param of the action of an intercept rule; its value is given as for matches
+type InterceptParam struct {
+	Name  string `mapstructure:"name" yaml:"name"`
+	Value string `mapstructure:"value" yaml:"value"`
+}
+
+// Returns the intercept rules declared via the configuration; none means the built-in rules are used
+func (c *Controller) interceptRules() []InterceptRule {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.config.InterceptRules
+}
+
+// Publishes the status of the named intercept rule and the error that caused it, if any
+func (c *Controller) updateInterceptRuleStatus(name string, status string, err error) {
+	message := ""
+	if err != nil {
+		message = err.Error()
+	}
+	path := interceptRuleStatePath(name)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.updateTree(
+		treeLeaf{path + "/status", stringVal(status)},
+		treeLeaf{path + "/error", stringVal(message)})
+}
+
+// Removes the status of the named intercept rule, which is no longer required
+func (c *Controller) deleteInterceptRuleStatus(name string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.deleteFromTree(interceptRuleStatePath(name))
+}
+
+// Returns the config tree path of the state of the named intercept rule
+func interceptRuleStatePath(name string) string {
+	return fmt.Sprintf("state/intercept-rule[name=%s]", escapeKey(name))
+}
+
+// Resolves the given intercept rule against the given P4Info, producing the table entry to be installed; returns
+// error describing the first name or value that does not resolve
+func resolveInterceptRule(info *p4info.P4Info, rule *InterceptRule) (*p4api.TableEntry, error) {
+	table := p4utils.FindTable(info, rule.Table)
+	if table == nil {
+		return nil, errors.NewNotFound("table %s not found", rule.Table)
+	}
+	entry := &p4api.TableEntry{TableId: table.Preamble.Id, Priority: rule.Priority}
+	for _, match := range rule.Matches {
+		field := p4utils.FindTableMatchField(table, match.Field)
+		if field == nil {
+			return nil, errors.NewNotFound("match field %s not found in table %s", match.Field, rule.Table)
+		}
+		fieldMatch, err := resolveFieldMatch(field, &match)
+		if err != nil {
+			return nil, err
+		}
+		entry.Match = append(entry.Match, fieldMatch)
+	}
+
+	action := p4utils.FindAction(info, rule.Action)
+	if action == nil {
+		return nil, errors.NewNotFound("action %s not found", rule.Action)
+	}
+	if !hasActionRef(table, action.Preamble.Id) {
+		return nil, errors.NewInvalid("action %s not allowed in table %s", rule.Action, rule.Table)
+	}
+	params := make(map[string]string)
+	for _, param := range rule.Params {
+		if p4utils.FindActionParam(action, param.Name) == nil {
+			return nil, errors.NewNotFound("param %s not found in action %s", param.Name, rule.Action)
+		}
+		params[param.Name] = param.Value
+	}
+	p4Action := &p4api.Action{ActionId: action.Preamble.Id}
+	for _, param := range action.Params {
+		value, ok := params[param.Name]
+		if !ok {
+			return nil, errors.NewInvalid("param %s of action %s not given", param.Name, rule.Action)
+		}
+		bytes, err := parseRuleValue(value, param.Bitwidth)
+		if err != nil {
+			return nil, errors.NewInvalid("invalid value of param %s: %s", param.Name, err.Error())
+		}
+		p4Action.Params = append(p4Action.Params, &p4api.Action_Param{ParamId: param.Id, Value: bytes})
+	}
+	entry.Action = &p4api.TableAction{Type: &p4api.TableAction_Action{Action: p4Action}}
+	return entry, nil
+}
+
+// Returns true if the given table allows the given action
+func hasActionRef(table *p4info.Table, actionID uint32) bool {
+	for _, ref := range table.ActionRefs {
+		if ref.Id == actionID {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolves the given match of the given field, per its match type
+func resolveFieldMatch(field *p4info.MatchField, match *InterceptMatch) (*p4api.FieldMatch, error) {
+	value, err := parseRuleValue(match.Value, field.Bitwidth)
+	if err != nil {
+		return nil, errors.NewInvalid("invalid value of match field %s: %s", match.Field, err.Error())
+	}
+	fieldMatch := &p4api.FieldMatch{FieldId: field.Id}
+	switch field.GetMatchType() {
+	case p4info.MatchField_EXACT, p4info.MatchField_OPTIONAL:
+		if match.Mask != "" {
+			return nil, errors.NewInvalid("mask not supported by %s match field %s", field.GetMatchType(), match.Field)
+		}
+		if field.GetMatchType() == p4info.MatchField_EXACT {
+			fieldMatch.FieldMatchType = &p4api.FieldMatch_Exact_{Exact: &p4api.FieldMatch_Exact{Value: value}}
+		} else {
+			fieldMatch.FieldMatchType = &p4api.FieldMatch_Optional_{Optional: &p4api.FieldMatch_Optional{Value: value}}
+		}
+	case p4info.MatchField_TERNARY:
+		mask := fullMask(field.Bitwidth)
+		if match.Mask != "" {
+			if mask, err = parseRuleValue(match.Mask, field.Bitwidth); err != nil {
+				return nil, errors.NewInvalid("invalid mask of match field %s: %s", match.Field, err.Error())
+			}
+		}
+		// Bits outside of the mask must be zero, lest the switch reject the entry
+		for i := range value {
+			value[i] &= mask[i]
+		}
+		fieldMatch.FieldMatchType = &p4api.FieldMatch_Ternary_{Ternary: &p4api.FieldMatch_Ternary{Value: value, Mask: mask}}
+	case p4info.MatchField_LPM:
+		prefixLen := int64(field.Bitwidth)
+		if match.Mask != "" {
+			if prefixLen, err = strconv.ParseInt(match.Mask, 10, 32); err != nil || prefixLen < 0 || prefixLen > int64(field.Bitwidth) {
+				return nil, errors.NewInvalid("invalid prefix length of match field %s: %s", match.Field, match.Mask)
+			}
+		}
+		fieldMatch.FieldMatchType = &p4api.FieldMatch_Lpm{Lpm: &p4api.FieldMatch_LPM{Value: value, PrefixLen: int32(prefixLen)}}
+	default:
+		return nil, errors.NewNotSupported("%s match field %s not supported", field.GetMatchType(), match.Field)
+	}
+	return fieldMatch, nil
+}
+
+// Parses the given value of a match field or action param of the given bit width, producing its bytes padded to the
+// width; numbers may be decimal or 0x-prefixed hexadecimal, and MAC or IP addresses are accepted as well
+func parseRuleValue(value string, bitwidth int32) ([]byte, error) {
+	width := int((bitwidth + 7) / 8)
+	var bytes []byte
+	if mac, err := net.ParseMAC(value); err == nil && strings.Contains(value, ":") {
+		bytes = mac
+	} else if ip := net.ParseIP(value); ip != nil {
+		if bytes = ip.To4(); bytes == nil || width > net.IPv4len {
+			bytes = ip.To16()
+		}
+	} else {
+		number, err := strconv.ParseUint(value, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %q", value)
+		}
+		if bitwidth < 64 && number>>uint(bitwidth) != 0 {
+			return nil, fmt.Errorf("%s exceeds %d bits", value, bitwidth)
+		}
+		bytes = binary.BigEndian.AppendUint64(nil, number)
+		for len(bytes) > width && bytes[0] == 0 {
+			bytes = bytes[1:]
+		}
+	}
+	if len(bytes) > width {
+		return nil, fmt.Errorf("%s exceeds %d bits", value, bitwidth)
+	}
+	return append(make([]byte, width-len(bytes)), bytes...), nil
+}
+
+// Returns mask with all bits of the given bit width set
+func fullMask(bitwidth int32) []byte {
+	width := int((bitwidth + 7) / 8)
+	mask := make([]byte, width)
+	for i := range mask {
+		mask[i] = 0xff
+	}
+	if extra := width*8 - int(bitwidth); width > 0 && extra > 0 {
+		mask[0] >>= uint(extra)
+	}
+	return mask
+}
+
+// Adds the given intercept rules to the config tree
+func addInterceptRulesToRoot(root *configtree.Node, rules []InterceptRule) {
+	for _, rule := range rules {
+		path := fmt.Sprintf("config/intercept-rule[name=%s]/", escapeKey(rule.Name))
+		root.AddPath(path+"table", stringVal(rule.Table))
+		root.AddPath(path+"action", stringVal(rule.Action))
+		root.AddPath(path+"priority", intVal(int64(rule.Priority)))
+		for _, match := range rule.Matches {
+			matchPath := fmt.Sprintf("%smatch[field=%s]/", path, escapeKey(match.Field))
+			root.AddPath(matchPath+"value", stringVal(match.Value))
+			root.AddPath(matchPath+"mask", stringVal(match.Mask))
+		}
+		for _, param := range rule.Params {
+			root.AddPath(fmt.Sprintf("%sparam[name=%s]/value", path, escapeKey(param.Name)), stringVal(param.Value))
+		}
+	}
+}
+
+// Returns the intercept rules declared via the config tree, ordered by name
+func getInterceptRules(root *configtree.Node) []InterceptRule {
+	rules := make(map[string]*InterceptRule)
+	for _, node := range root.FindAll("config/intercept-rule[name=...]") {
+		elems := gnmiutils.ToPath(node.Path()).Elem
+		if len(elems) < 3 {
+			continue
+		}
+		name := unescapeKey(elems[1].Key["name"])
+		rule, ok := rules[name]
+		if !ok {
+			rule = &InterceptRule{Name: name}
+			rules[name] = rule
+		}
+		switch {
+		case len(elems) == 3 && elems[2].Name == "table":
+			rule.Table = node.Value().GetStringVal()
+		case len(elems) == 3 && elems[2].Name == "action":
+			rule.Action = node.Value().GetStringVal()
+		case len(elems) == 3 && elems[2].Name == "priority":
+			rule.Priority = int32(node.Value().GetIntVal())
+		case len(elems) == 4 && elems[2].Name == "match":
+			match := findInterceptMatch(rule, unescapeKey(elems[2].Key["field"]))
+			if elems[3].Name == "value" {
+				match.Value = node.Value().GetStringVal()
+			} else if elems[3].Name == "mask" {
+				match.Mask = node.Value().GetStringVal()
+			}
+		case len(elems) == 4 && elems[2].Name == "param" && elems[3].Name == "value":
+			rule.Params = append(rule.Params, InterceptParam{Name: unescapeKey(elems[2].Key["name"]), Value: node.Value().GetStringVal()})
+		}
+	}
+
+	list := make([]InterceptRule, 0, len(rules))
+	for _, rule := range rules {
+		sort.Slice(rule.Matches, func(i, j int) bool { return rule.Matches[i].Field < rule.Matches[j].Field })
+		sort.Slice(rule.Params, func(i, j int) bool { return rule.Params[i].Name < rule.Params[j].Name })
+		list = append(list, *rule)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Returns the match of the given field of the given rule, adding it if necessary
+func findInterceptMatch(rule *InterceptRule, field string) *InterceptMatch {
+	for i := range rule.Matches {
+		if rule.Matches[i].Field == field {
+			return &rule.Matches[i]
+		}
+	}
+	rule.Matches = append(rule.Matches, InterceptMatch{Field: field})
+	return &rule.Matches[len(rule.Matches)-1]
+}
@@ -0,0 +1,304 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"context"
+	"github.com/onosproject/onos-net-lib/pkg/configtree"
+	p4info "github.com/p4lang/p4runtime/go/p4/config/v1"
+	p4api "github.com/p4lang/p4runtime/go/p4/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"testing"
+)
+
+// P4Runtime client that records the updates written to it
+type fakeWriteClient struct {
+	p4api.P4RuntimeClient
+	updates []*p4api.Update
+}
+
+func (f *fakeWriteClient) Write(ctx context.Context, req *p4api.WriteRequest, opts ...grpc.CallOption) (*p4api.WriteResponse, error) {
+	f.updates = append(f.updates, req.Updates...)
+	return &p4api.WriteResponse{}, nil
+}
+
+// Returns the number of recorded updates of the given type
+func (f *fakeWriteClient) count(updateType p4api.Update_Type) int {
+	count := 0
+	for _, update := range f.updates {
+		if update.Type == updateType {
+			count++
+		}
+	}
+	return count
+}
+
+// Forgets all recorded updates
+func (f *fakeWriteClient) reset() {
+	f.updates = nil
+}
+
+// Produces controller with the given P4Info, whose writes to the switch are recorded
+func newInterceptTestController(t *testing.T, info *p4info.P4Info) (*Controller, *fakeWriteClient) {
+	c, _ := newTestController(t)
+	client := &fakeWriteClient{}
+	c.ctx = context.Background()
+	c.p4Client = client
+	c.info = info
+	return c, client
+}
+
+// Produces P4Info with the ACL table and actions of fabric-tna used by the built-in rules
+func newTestFabricP4Info() *p4info.P4Info {
+	ternary := &p4info.MatchField_MatchType_{MatchType: p4info.MatchField_TERNARY}
+	return &p4info.P4Info{
+		Tables: []*p4info.Table{{
+			Preamble: &p4info.Preamble{Id: 1, Name: "FabricIngress.acl.acl"},
+			MatchFields: []*p4info.MatchField{
+				{Id: 1, Name: "eth_type", Bitwidth: 16, Match: ternary},
+				{Id: 2, Name: "ip_proto", Bitwidth: 8, Match: ternary},
+				{Id: 3, Name: "icmp_type", Bitwidth: 8, Match: ternary},
+				{Id: 4, Name: "l4_dport", Bitwidth: 16, Match: ternary},
+			},
+			ActionRefs: []*p4info.ActionRef{{Id: 10}, {Id: 11}},
+		}},
+		Actions: []*p4info.Action{
+			{
+				Preamble: &p4info.Preamble{Id: 10, Name: "FabricIngress.acl.punt_to_cpu"},
+				Params:   []*p4info.Action_Param{{Id: 1, Name: "set_role_agent_id", Bitwidth: 8}},
+			},
+			{
+				Preamble: &p4info.Preamble{Id: 11, Name: "FabricIngress.acl.copy_to_cpu"},
+				Params:   []*p4info.Action_Param{{Id: 1, Name: "set_role_agent_id", Bitwidth: 8}},
+			},
+		},
+	}
+}
+
+// Produces P4Info of a pipeline with a single punt table, unlike fabric-tna
+func newTestP4Info() *p4info.P4Info {
+	return &p4info.P4Info{
+		Tables: []*p4info.Table{{
+			Preamble: &p4info.Preamble{Id: 1, Name: "Ingress.punt"},
+			MatchFields: []*p4info.MatchField{
+				{Id: 1, Name: "port", Bitwidth: 9, Match: &p4info.MatchField_MatchType_{MatchType: p4info.MatchField_TERNARY}},
+				{Id: 2, Name: "eth_type", Bitwidth: 16, Match: &p4info.MatchField_MatchType_{MatchType: p4info.MatchField_EXACT}},
+				{Id: 3, Name: "dst_addr", Bitwidth: 32, Match: &p4info.MatchField_MatchType_{MatchType: p4info.MatchField_LPM}},
+				{Id: 4, Name: "eth_dst", Bitwidth: 48, Match: &p4info.MatchField_MatchType_{MatchType: p4info.MatchField_RANGE}},
+			},
+			ActionRefs: []*p4info.ActionRef{{Id: 10}},
+		}},
+		Actions: []*p4info.Action{
+			{
+				Preamble: &p4info.Preamble{Id: 10, Name: "Ingress.to_cpu"},
+				Params:   []*p4info.Action_Param{{Id: 1, Name: "reason", Bitwidth: 8}},
+			},
+			{Preamble: &p4info.Preamble{Id: 11, Name: "Ingress.drop"}},
+		},
+	}
+}
+
+func newTestInterceptRule() *InterceptRule {
+	return &InterceptRule{
+		Name:  "LLDP",
+		Table: "Ingress.punt",
+		Matches: []InterceptMatch{
+			{Field: "eth_type", Value: "0x88cc"},
+			{Field: "port", Value: "3"},
+			{Field: "dst_addr", Value: "10.0.0.0", Mask: "8"},
+		},
+		Action:   "Ingress.to_cpu",
+		Params:   []InterceptParam{{Name: "reason", Value: "7"}},
+		Priority: 100,
+	}
+}
+
+func TestResolveInterceptRule(t *testing.T) {
+	entry, err := resolveInterceptRule(newTestP4Info(), newTestInterceptRule())
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), entry.TableId)
+	assert.Equal(t, int32(100), entry.Priority)
+	assert.Len(t, entry.Match, 3)
+	assert.Equal(t, []byte{0x88, 0xcc}, entry.Match[0].GetExact().Value)
+	assert.Equal(t, []byte{0, 3}, entry.Match[1].GetTernary().Value)
+	assert.Equal(t, []byte{0x01, 0xff}, entry.Match[1].GetTernary().Mask)
+
+	// Ternary value is masked, so that no bits outside of the mask are set
+	rule := newTestInterceptRule()
+	rule.Matches[1].Mask = "0x0f0"
+	rule.Matches[1].Value = "0x1ff"
+	entry, err = resolveInterceptRule(newTestP4Info(), rule)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x00, 0xf0}, entry.Match[1].GetTernary().Value)
+	assert.Equal(t, []byte{0x00, 0xf0}, entry.Match[1].GetTernary().Mask)
+	assert.Equal(t, []byte{10, 0, 0, 0}, entry.Match[2].GetLpm().Value)
+	assert.Equal(t, int32(8), entry.Match[2].GetLpm().PrefixLen)
+	assert.Equal(t, uint32(10), entry.Action.GetAction().ActionId)
+	assert.Equal(t, []*p4api.Action_Param{{ParamId: 1, Value: []byte{7}}}, entry.Action.GetAction().Params)
+}
+
+func TestResolveInterceptRule_Errors(t *testing.T) {
+	info := newTestP4Info()
+	for reason, mutate := range map[string]func(r *InterceptRule){
+		"table":        func(r *InterceptRule) { r.Table = "Ingress.acl" },
+		"match field":  func(r *InterceptRule) { r.Matches[0].Field = "ether_type" },
+		"match type":   func(r *InterceptRule) { r.Matches = []InterceptMatch{{Field: "eth_dst", Value: "00:00:00:00:00:01"}} },
+		"match value":  func(r *InterceptRule) { r.Matches[0].Value = "0x188cc" },
+		"exact mask":   func(r *InterceptRule) { r.Matches[0].Mask = "0xffff" },
+		"prefix":       func(r *InterceptRule) { r.Matches[2].Mask = "33" },
+		"action":       func(r *InterceptRule) { r.Action = "punt_to_cpu" },
+		"action ref":   func(r *InterceptRule) { r.Action = "Ingress.drop" },
+		"param":        func(r *InterceptRule) { r.Params[0].Name = "set_role_agent_id" },
+		"no param":     func(r *InterceptRule) { r.Params = nil },
+		"param value":  func(r *InterceptRule) { r.Params[0].Value = "foo" },
+		"param length": func(r *InterceptRule) { r.Params[0].Value = "256" },
+	} {
+		rule := newTestInterceptRule()
+		mutate(rule)
+		_, err := resolveInterceptRule(info, rule)
+		assert.Error(t, err, reason)
+	}
+}
+
+func TestParseRuleValue(t *testing.T) {
+	for _, tc := range []struct {
+		value    string
+		bitwidth int32
+		bytes    []byte
+	}{
+		{"2048", 16, []byte{0x08, 0x00}},
+		{"0x1", 9, []byte{0, 1}},
+		{"0", 32, []byte{0, 0, 0, 0}},
+		{"00:00:00:00:00:0a", 48, []byte{0, 0, 0, 0, 0, 10}},
+		{"192.168.1.1", 32, []byte{192, 168, 1, 1}},
+		{"fe80::1", 128, append(append([]byte{0xfe, 0x80}, make([]byte, 13)...), 1)},
+	} {
+		bytes, err := parseRuleValue(tc.value, tc.bitwidth)
+		assert.NoError(t, err, tc.value)
+		assert.Equal(t, tc.bytes, bytes, tc.value)
+	}
+
+	for _, value := range []string{"", "-1", "0x200", "00:00:00:00:00:0a", "fe80::1"} {
+		_, err := parseRuleValue(value, 9)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestGetInterceptRules(t *testing.T) {
+	rule := newTestInterceptRule()
+	other := InterceptRule{Name: "ARP [1/2], 100%", Table: "Ingress.punt", Action: "Ingress.to_cpu"}
+	root := configtree.NewRoot()
+	addInterceptRulesToRoot(root, []InterceptRule{*rule, other})
+	assert.NotNil(t, root.GetPath("config/intercept-rule[name=ARP %5B1%2F2%5D%2C 100%25]/table"))
+
+	// Rules read back from the tree are ordered by name, as are their matches and params
+	rule.Matches = []InterceptMatch{rule.Matches[2], rule.Matches[0], rule.Matches[1]}
+	assert.Equal(t, []InterceptRule{other, *rule}, getInterceptRules(root))
+	assert.Empty(t, getInterceptRules(configtree.NewRoot()))
+}
+
+func TestController_DeclaredInterceptRules(t *testing.T) {
+	c, client := newInterceptTestController(t, newTestP4Info())
+	rule := newTestInterceptRule()
+	rule.Table = "FabricIngress.acl.acl"
+	c.config.InterceptRules = []InterceptRule{*rule}
+
+	// Rules that do not resolve are reported as invalid and are not programmed
+	c.programPacketInterceptRules()
+	assert.Equal(t, interceptInvalid, c.Root().GetPath("state/intercept-rule[name=LLDP]/status").Value().GetStringVal())
+	assert.Contains(t, c.Root().GetPath("state/intercept-rule[name=LLDP]/error").Value().GetStringVal(), "FabricIngress.acl.acl")
+	assert.Empty(t, c.programmedIntercepts)
+	assert.Empty(t, client.updates)
+
+	// Status of installed rules carries no error
+	rule.Table = "Ingress.punt"
+	c.config.InterceptRules = []InterceptRule{*rule}
+	c.syncInterceptRules()
+	assert.Equal(t, 1, client.count(p4api.Update_INSERT))
+	assert.Equal(t, interceptInstalled, c.Root().GetPath("state/intercept-rule[name=LLDP]/status").Value().GetStringVal())
+	assert.Equal(t, "", c.Root().GetPath("state/intercept-rule[name=LLDP]/error").Value().GetStringVal())
+
+	// Unchanged rules are left alone
+	client.reset()
+	c.syncInterceptRules()
+	assert.Empty(t, client.updates)
+
+	// Rules whose action changed are modified in place, while those whose match changed are replaced
+	rule.Params[0].Value = "8"
+	c.config.InterceptRules = []InterceptRule{*rule}
+	c.syncInterceptRules()
+	assert.Equal(t, 1, client.count(p4api.Update_MODIFY))
+	assert.Len(t, client.updates, 1)
+
+	client.reset()
+	rule.Priority = 200
+	c.config.InterceptRules = []InterceptRule{*rule}
+	c.syncInterceptRules()
+	assert.Equal(t, p4api.Update_DELETE, client.updates[0].Type)
+	assert.Equal(t, int32(100), client.updates[0].Entity.GetTableEntry().Priority)
+	assert.Equal(t, p4api.Update_INSERT, client.updates[1].Type)
+	assert.Equal(t, int32(200), client.updates[1].Entity.GetTableEntry().Priority)
+
+	// Removed rules are deleted along with their status, and rule names are escaped in paths
+	client.reset()
+	other := InterceptRule{Name: "ARP/1", Table: "Ingress.punt", Action: "Ingress.to_cpu", Params: []InterceptParam{{Name: "reason", Value: "1"}}}
+	c.config.InterceptRules = []InterceptRule{other}
+	c.syncInterceptRules()
+	assert.Equal(t, 1, client.count(p4api.Update_DELETE))
+	assert.Equal(t, 1, client.count(p4api.Update_INSERT))
+	assert.Nil(t, c.Root().GetPath("state/intercept-rule[name=LLDP]/status"))
+	assert.Equal(t, interceptInstalled, c.Root().GetPath("state/intercept-rule[name=ARP%2F1]/status").Value().GetStringVal())
+
+	// Rules that became invalid are deleted, yet still reported
+	client.reset()
+	other.Action = "Ingress.drop"
+	c.config.InterceptRules = []InterceptRule{other}
+	c.syncInterceptRules()
+	assert.Equal(t, 1, client.count(p4api.Update_DELETE))
+	assert.Len(t, client.updates, 1)
+	assert.Equal(t, interceptInvalid, c.Root().GetPath("state/intercept-rule[name=ARP%2F1]/status").Value().GetStringVal())
+}
+
+func TestController_BuiltInInterceptRules(t *testing.T) {
+	c, client := newInterceptTestController(t, newTestFabricP4Info())
+
+	// Built-in rules punt LLDP and ARP, and copy the NDP messages, so that neighbor discovery is not disrupted
+	c.config.IPv6HostLearning = true
+	c.programPacketInterceptRules()
+	assert.Equal(t, 4, client.count(p4api.Update_INSERT))
+	assert.Len(t, c.programmedIntercepts, 4)
+	assert.Equal(t, interceptInstalled, c.Root().GetPath("state/intercept-rule[name=LLDP]/status").Value().GetStringVal())
+	assert.Equal(t, uint32(10), c.programmedIntercepts["LLDP"].Action.GetAction().ActionId)
+	assert.Equal(t, uint32(11), c.programmedIntercepts["ICMPv6 type 135"].Action.GetAction().ActionId)
+	assert.Equal(t, uint32(11), c.programmedIntercepts["ICMPv6 type 136"].Action.GetAction().ActionId)
+
+	// Rules of features that have been disabled are deleted, and of those enabled inserted
+	client.reset()
+	c.config.IPv6HostLearning = false
+	c.config.DHCPSnooping = true
+	c.syncInterceptRules()
+	assert.Equal(t, 2, client.count(p4api.Update_DELETE))
+	assert.Equal(t, 2, client.count(p4api.Update_INSERT))
+	assert.Nil(t, c.Root().GetPath("state/intercept-rule[name=ICMPv6 type 135]/status"))
+	assert.Equal(t, interceptInstalled, c.Root().GetPath("state/intercept-rule[name=DHCP port 67]/status").Value().GetStringVal())
+
+	// Declared rules take the place of all built-in ones
+	client.reset()
+	c.config.InterceptRules = []InterceptRule{{
+		Name:    "lldp",
+		Table:   "FabricIngress.acl.acl",
+		Matches: []InterceptMatch{{Field: "eth_type", Value: "0x88cc"}},
+		Action:  "FabricIngress.acl.punt_to_cpu",
+		Params:  []InterceptParam{{Name: "set_role_agent_id", Value: "3"}},
+	}}
+	c.syncInterceptRules()
+	assert.Equal(t, 4, client.count(p4api.Update_DELETE))
+	assert.Equal(t, 1, client.count(p4api.Update_INSERT))
+	assert.Equal(t, p4api.Update_INSERT, client.updates[len(client.updates)-1].Type)
+	assert.Len(t, c.programmedIntercepts, 1)
+	assert.Nil(t, c.Root().GetPath("state/intercept-rule[name=LLDP]/status"))
+	assert.Equal(t, interceptInstalled, c.Root().GetPath("state/intercept-rule[name=lldp]/status").Value().GetStringVal())
+}
@@ -0,0 +1,234 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/google/gopacket/layers"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// Modes of link latency measurement
+	latencyNone      = "none"       // latency is not measured
+	latencyOneWay    = "one-way"    // one-way delay is measured; requires synchronized clocks
+	latencyRoundTrip = "round-trip" // one-way delay and round-trip time, via probes echoed by the neighbor, are measured
+
+	lldpProbeTLVLength = 8 + 4
+	lldpEchoTLVLength  = 8 + 8 // not counting the chassis and port IDs of the probe sender, each prefixed by length
+
+	// Max number of probes echoed in a single LLDP packet, so that the packet stays well within the MTU
+	maxEchoes = 8
+
+	// Gains of the moving average and of the jitter estimate, per RFC 6298 and RFC 3550 respectively
+	latencyAverageGain = 8
+	latencyJitterGain  = 16
+)
+
+// LatencyStats holds statistics of the latency samples of a link
+type LatencyStats struct {
+	Samples int64
+	Min     time.Duration
+	Avg     time.Duration // exponentially weighted moving average
+	Max     time.Duration
+	Jitter  time.Duration // mean deviation of consecutive samples
+	last    time.Duration
+}
+
+// Probe received from a neighbor, retained to be echoed back
+type probeEcho struct {
+	timestamp  uint64
+	receivedAt time.Time
+}
+
+// Incorporates the given sample into the statistics
+func (s *LatencyStats) add(sample time.Duration) {
+	if s.Samples == 0 {
+		s.Min, s.Avg, s.Max = sample, sample, sample
+	} else {
+		if sample < s.Min {
+			s.Min = sample
+		}
+		if sample > s.Max {
+			s.Max = sample
+		}
+		s.Avg += (sample - s.Avg) / latencyAverageGain
+		delta := sample - s.last
+		if delta < 0 {
+			delta = -delta
+		}
+		s.Jitter += (delta - s.Jitter) / latencyJitterGain
+	}
+	s.last = sample
+	s.Samples++
+}
+
+// Returns the configured latency measurement mode
+func (c *Controller) latencyMode() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	switch c.config.LatencyMode {
+	case latencyOneWay, latencyRoundTrip:
+		return c.config.LatencyMode
+	default:
+		return latencyNone
+	}
+}
+
+// Returns the sequence number for the next round of emitted LLDP packets
+func (c *Controller) nextProbeSequence() uint32 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.probeSequence++
+	return c.probeSequence
+}
+
+// Produces the probe TLV with the given send time and sequence number
+func newProbeTLV(sentAt time.Time, sequence uint32) layers.LinkLayerDiscoveryValue {
+	value := binary.BigEndian.AppendUint64(make([]byte, 0, lldpProbeTLVLength), uint64(sentAt.UnixNano()))
+	return newOrgTLV(lldpProbeSubtype, binary.BigEndian.AppendUint32(value, sequence))
+}
+
+// Returns the send timestamp and the sequence number carried by the probe TLV of the given LLDP packet; returns false
+// if the packet carries no valid probe TLV
+func parseProbeTLV(info *layers.LinkLayerDiscoveryInfo) (uint64, uint32, bool) {
+	probe := findOrgTLV(info, lldpProbeSubtype)
+	if len(probe) != lldpProbeTLVLength {
+		return 0, 0, false
+	}
+	return binary.BigEndian.Uint64(probe), binary.BigEndian.Uint32(probe[8:]), true
+}
+
+// Produces the echo TLVs for the last probes received from each neighbor on the given port, if round-trip time is
+// measured; each echo is addressed to the sender of the probe, so that other neighbors heard on the same port, e.g.
+// via a shared segment or on another VLAN, do not take it for their own; the most recent probes are echoed first
+func (c *Controller) newEchoTLVs(portNumber uint32) []layers.LinkLayerDiscoveryValue {
+	if c.latencyMode() != latencyRoundTrip {
+		return nil
+	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	echoes := make([]linkKey, 0)
+	for key := range c.echoes {
+		if key.ingressPort == portNumber {
+			echoes = append(echoes, key)
+		}
+	}
+	sort.Slice(echoes, func(i, j int) bool { return c.echoes[echoes[i]].receivedAt.After(c.echoes[echoes[j]].receivedAt) })
+	if len(echoes) > maxEchoes {
+		echoes = echoes[:maxEchoes]
+	}
+
+	tlvs := make([]layers.LinkLayerDiscoveryValue, 0, len(echoes))
+	for _, key := range echoes {
+		echo := c.echoes[key]
+		// Time the probe spent with us is reported, so that the neighbor can discount it
+		value := binary.BigEndian.AppendUint64(make([]byte, 0, lldpEchoTLVLength), echo.timestamp)
+		value = binary.BigEndian.AppendUint64(value, uint64(c.now().Sub(echo.receivedAt)))
+		value = appendShortString(appendShortString(value, key.egressDeviceID), key.egressPortID)
+		tlvs = append(tlvs, newOrgTLV(lldpEchoSubtype, value))
+	}
+	return tlvs
+}
+
+// Returns the send time and the dwell time of the probe echoed by the given LLDP packet to the given port of this
+// agent; returns false if the packet carries no echo addressed to that port
+func (c *Controller) parseEchoTLVs(portNumber uint32, info *layers.LinkLayerDiscoveryInfo) (time.Time, time.Duration, bool) {
+	portID := fmt.Sprintf("%d", portNumber)
+	if info != nil {
+		for _, tlv := range info.OrgTLVs {
+			if tlv.OUI != onfOUI || tlv.SubType != lldpEchoSubtype || len(tlv.Info) < lldpEchoTLVLength {
+				continue
+			}
+			chassisID, rest, ok := parseShortString(tlv.Info[lldpEchoTLVLength:])
+			if !ok || chassisID != c.IngressDeviceID {
+				continue
+			}
+			if echoedPortID, _, ok := parseShortString(rest); ok && echoedPortID == portID {
+				return time.Unix(0, int64(binary.BigEndian.Uint64(tlv.Info))),
+					time.Duration(binary.BigEndian.Uint64(tlv.Info[8:])), true
+			}
+		}
+	}
+	return time.Time{}, 0, false
+}
+
+// Appends the given string, prefixed by its length, which is limited to 255 bytes
+func appendShortString(value []byte, s string) []byte {
+	if len(s) > math.MaxUint8 {
+		s = s[:math.MaxUint8]
+	}
+	return append(append(value, byte(len(s))), s...)
+}
+
+// Parses the string prefixed by its length from the given value, returning the rest of the value; returns false if
+// the value is too short
+func parseShortString(value []byte) (string, []byte, bool) {
+	if len(value) < 1 || len(value) < 1+int(value[0]) {
+		return "", nil, false
+	}
+	return string(value[1 : 1+value[0]]), value[1+value[0]:], true
+}
+
+// Records latency samples of the given link from the probe and echo TLVs of the LLDP packet received for it
+func (c *Controller) updateLinkLatency(key linkKey, info *layers.LinkLayerDiscoveryInfo) {
+	mode := c.latencyMode()
+	if mode == latencyNone {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	link, ok := c.links[key]
+	if !ok {
+		return
+	}
+	now := c.now()
+
+	leaves := make([]treeLeaf, 0)
+	if timestamp, _, ok := parseProbeTLV(info); ok {
+		if mode == latencyRoundTrip {
+			c.echoes[key] = &probeEcho{timestamp: timestamp, receivedAt: now}
+		}
+
+		// Negative delay can only stem from clocks that are not synchronized, so such samples are discarded
+		if delay := now.Sub(time.Unix(0, int64(timestamp))); delay >= 0 {
+			if link.OneWayLatency == nil {
+				link.OneWayLatency = &LatencyStats{}
+			}
+			link.OneWayLatency.add(delay)
+			leaves = append(leaves, latencyLeaves(c.linkPath(key)+"/latency/one-way/", link.OneWayLatency)...)
+		}
+	}
+
+	// Echo carries our own send time, so the round-trip time does not depend on synchronized clocks
+	if sentAt, dwell, ok := c.parseEchoTLVs(key.ingressPort, info); mode == latencyRoundTrip && ok {
+		if rtt := now.Sub(sentAt) - dwell; rtt >= 0 {
+			if link.RoundTripLatency == nil {
+				link.RoundTripLatency = &LatencyStats{}
+			}
+			link.RoundTripLatency.add(rtt)
+			leaves = append(leaves, latencyLeaves(c.linkPath(key)+"/latency/round-trip/", link.RoundTripLatency)...)
+		}
+	}
+
+	if len(leaves) > 0 && !c.isLinkSuppressed(key) {
+		c.updateTree(leaves...)
+	}
+}
+
+// Returns the config tree leaves of the given latency statistics, with durations in nanoseconds
+func latencyLeaves(path string, stats *LatencyStats) []treeLeaf {
+	return []treeLeaf{
+		{path + "samples", intVal(stats.Samples)},
+		{path + "min", intVal(int64(stats.Min))},
+		{path + "avg", intVal(int64(stats.Avg))},
+		{path + "max", intVal(int64(stats.Max))},
+		{path + "jitter", intVal(int64(stats.Jitter))},
+	}
+}
@@ -0,0 +1,127 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLatencyStats(t *testing.T) {
+	stats := &LatencyStats{}
+	stats.add(10 * time.Millisecond)
+	assert.Equal(t, int64(1), stats.Samples)
+	assert.Equal(t, 10*time.Millisecond, stats.Avg)
+	assert.Equal(t, time.Duration(0), stats.Jitter)
+
+	stats.add(26 * time.Millisecond)
+	stats.add(2 * time.Millisecond)
+	assert.Equal(t, int64(3), stats.Samples)
+	assert.Equal(t, 2*time.Millisecond, stats.Min)
+	assert.Equal(t, 26*time.Millisecond, stats.Max)
+	assert.Equal(t, 10750*time.Microsecond, stats.Avg)
+	assert.Equal(t, 2437500*time.Nanosecond, stats.Jitter)
+}
+
+func TestController_OneWayLatency(t *testing.T) {
+	c, clock := newTestController(t)
+	neighbor, _ := newTestController(t)
+	neighbor.IngressDeviceID = "foo"
+	neighbor.now = clock.now
+
+	// Probes should be ignored unless latency is measured
+	c.processLLDPPacket(1, newAgentLLDPPacket(t, neighbor, 10, 30))
+	assert.Nil(t, c.GetLinks()[0].OneWayLatency)
+	assert.Nil(t, c.Root().GetPath("state/link[port=1,device=foo,egress-port=10]/latency/one-way/samples"))
+
+	c.config.LatencyMode = latencyOneWay
+	packet := newAgentLLDPPacket(t, neighbor, 10, 30)
+	clock.advance(3 * time.Millisecond)
+	c.processLLDPPacket(1, packet)
+	packet = newAgentLLDPPacket(t, neighbor, 10, 30)
+	clock.advance(5 * time.Millisecond)
+	c.processLLDPPacket(1, packet)
+
+	stats := c.GetLinks()[0].OneWayLatency
+	assert.Equal(t, int64(2), stats.Samples)
+	assert.Equal(t, 3*time.Millisecond, stats.Min)
+	assert.Equal(t, 5*time.Millisecond, stats.Max)
+	assert.Nil(t, c.GetLinks()[0].RoundTripLatency)
+	assert.Equal(t, int64(5*time.Millisecond),
+		c.Root().GetPath("state/link[port=1,device=foo,egress-port=10]/latency/one-way/max").Value().GetIntVal())
+
+	// Probes that appear to arrive before they were sent, as the neighbor clock is ahead, should be discarded
+	neighbor.now = func() time.Time { return clock.now().Add(time.Second) }
+	c.processLLDPPacket(1, newAgentLLDPPacket(t, neighbor, 10, 30))
+	stats = c.GetLinks()[0].OneWayLatency
+	assert.Equal(t, int64(2), stats.Samples)
+	assert.Equal(t, 3*time.Millisecond, stats.Min)
+}
+
+func TestController_RoundTripLatency(t *testing.T) {
+	c, clock := newTestController(t)
+	neighbor, _ := newTestController(t)
+	neighbor.IngressDeviceID = "foo"
+	neighbor.now = clock.now
+	c.IngressDeviceID = "bar"
+	c.config.LatencyMode = latencyRoundTrip
+	neighbor.config.LatencyMode = latencyRoundTrip
+
+	// Probe from c reaches the neighbor after 2ms, which echoes it back 100ms later, taking another 3ms
+	packet := newAgentLLDPPacket(t, c, 1, 30)
+	clock.advance(2 * time.Millisecond)
+	neighbor.processLLDPPacket(10, packet)
+	clock.advance(100 * time.Millisecond)
+	packet = newAgentLLDPPacket(t, neighbor, 10, 30)
+	clock.advance(3 * time.Millisecond)
+	c.processLLDPPacket(1, packet)
+
+	stats := c.GetLinks()[0].RoundTripLatency
+	assert.Equal(t, int64(1), stats.Samples)
+	assert.Equal(t, 5*time.Millisecond, stats.Avg)
+	assert.Equal(t, int64(5*time.Millisecond),
+		c.Root().GetPath("state/link[port=1,device=foo,egress-port=10]/latency/round-trip/avg").Value().GetIntVal())
+	assert.Equal(t, 3*time.Millisecond, c.GetLinks()[0].OneWayLatency.Min)
+}
+
+func TestController_RoundTripLatencyNeighbors(t *testing.T) {
+	c, clock := newTestController(t)
+	c.IngressDeviceID = "bar"
+	c.config.LatencyMode = latencyRoundTrip
+	foo, _ := newTestController(t)
+	foo.IngressDeviceID = "foo"
+	foo.config.LatencyMode = latencyRoundTrip
+	foo.now = clock.now
+	baz, _ := newTestController(t)
+	baz.IngressDeviceID = "baz"
+	baz.config.LatencyMode = latencyRoundTrip
+	baz.now = clock.now
+
+	// Both neighbors hear each other's probes on a shared segment, and the echo of each is addressed to its sender
+	fooProbe := newAgentLLDPPacket(t, foo, 10, 30)
+	clock.advance(time.Millisecond)
+	bazProbe := newAgentLLDPPacket(t, baz, 20, 30)
+	clock.advance(time.Millisecond)
+	c.processLLDPPacket(1, fooProbe)
+	c.processLLDPPacket(1, bazProbe)
+	echo := newAgentLLDPPacket(t, c, 1, 30)
+	assert.Len(t, c.newEchoTLVs(1), 2)
+
+	// Echo reaching foo yields its round-trip time, not that of the probe of baz
+	clock.advance(3 * time.Millisecond)
+	foo.processLLDPPacket(10, echo)
+	assert.Equal(t, 5*time.Millisecond, foo.GetLinks()[0].RoundTripLatency.Avg)
+	baz.processLLDPPacket(20, echo)
+	assert.Equal(t, 4*time.Millisecond, baz.GetLinks()[0].RoundTripLatency.Avg)
+
+	// Echoes addressed to another port are ignored
+	foo.processLLDPPacket(11, echo)
+	for _, link := range foo.GetLinks() {
+		if link.IngressPort == 11 {
+			assert.Nil(t, link.RoundTripLatency)
+		}
+	}
+}
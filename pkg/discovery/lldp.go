@@ -0,0 +1,195 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"math"
+	"net"
+	"time"
+)
+
+// Source MAC address of the emitted LLDP packets; same as what SONiC uses
+var lldpSourceMAC = net.HardwareAddr{0x00, 0x60, 0x08, 0x69, 0x97, 0xef}
+
+// OUI and subtypes of the organizationally specific TLVs added to the emitted LLDP packets
+const (
+	onfOUI            layers.IEEEOUI = 0xa42305
+	lldpAuthSubtype   uint8          = 0x81
+	lldpProbeSubtype  uint8          = 0x82
+	lldpEchoSubtype   uint8          = 0x83
+	lldpDigestSubtype uint8          = 0x84
+)
+
+// Produces organizationally specific TLV with the given subtype and value
+func newOrgTLV(subtype uint8, value []byte) layers.LinkLayerDiscoveryValue {
+	tlv := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(value)), uint32(onfOUI)<<8|uint32(subtype))
+	tlv = append(tlv, value...)
+	return layers.LinkLayerDiscoveryValue{Type: layers.LLDPTLVOrgSpecific, Length: uint16(len(tlv)), Value: tlv}
+}
+
+// Returns the value of the last organizationally specific TLV with the given subtype; nil if there is none
+func findOrgTLV(info *layers.LinkLayerDiscoveryInfo, subtype uint8) []byte {
+	var value []byte
+	if info != nil {
+		for _, tlv := range info.OrgTLVs {
+			if tlv.OUI == onfOUI && tlv.SubType == subtype {
+				value = tlv.Info
+			}
+		}
+	}
+	return value
+}
+
+// Returns true if the given LLDP info carries any of our organizationally specific TLVs
+func hasOrgTLVs(info *layers.LinkLayerDiscoveryInfo) bool {
+	if info != nil {
+		for _, tlv := range info.OrgTLVs {
+			if tlv.OUI == onfOUI {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the TTL to advertise in the emitted LLDP packets
+func (c *Controller) lldpTTL() uint16 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return uint16(math.Max(0, math.Min(float64(c.config.LLDPTTL), math.MaxUint16)))
+}
+
+// Produces LLDP packet advertising the given port of this agent, with the given TTL and probe sequence number
+func (c *Controller) lldpPacket(portNumber uint32, ttl uint16, sequence uint32) ([]byte, error) {
+	return c.discoveryPacket(layers.EthernetTypeLinkLayerDiscovery, portNumber, ttl, sequence)
+}
+
+// Produces packet with the given ethernet type and LLDP payload advertising the given port of this agent, with the
+// given TTL and probe sequence number
+func (c *Controller) discoveryPacket(ethType layers.EthernetType, portNumber uint32, ttl uint16, sequence uint32) ([]byte, error) {
+	eth := &layers.Ethernet{
+		SrcMAC:       lldpSourceMAC,
+		DstMAC:       net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		EthernetType: ethType,
+	}
+
+	lldp := &layers.LinkLayerDiscovery{
+		ChassisID: layers.LLDPChassisID{
+			Subtype: layers.LLDPChassisIDSubTypeLocal,
+			ID:      []byte(c.IngressDeviceID),
+		},
+		PortID: layers.LLDPPortID{
+			Subtype: layers.LLDPPortIDSubtypeLocal,
+			ID:      []byte(fmt.Sprintf("%d", portNumber)),
+		},
+		TTL:    ttl,
+		Values: []layers.LinkLayerDiscoveryValue{newProbeTLV(c.now(), sequence)},
+	}
+	lldp.Values = append(lldp.Values, c.newEchoTLVs(portNumber)...)
+	if digest, ok := c.newDigestTLV(portNumber); ok {
+		lldp.Values = append(lldp.Values, digest)
+	}
+
+	// Authenticate the packet if we have a shared key
+	if key := c.lldpAuthKey(); key != nil {
+		tlv, err := newLLDPAuthTLV(key, lldp.ChassisID.ID, lldp.PortID.ID, c.nextLLDPAuthTimestamp())
+		if err != nil {
+			return nil, err
+		}
+		lldp.Values = append(lldp.Values, tlv)
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{
+		FixLengths:       true,
+		ComputeChecksums: true,
+	}
+	err := gopacket.SerializeLayers(buf, opts, eth, lldp)
+	return buf.Bytes(), err
+}
+
+// Processes the LLDP packet received on the given ingress port, updating the corresponding link
+func (c *Controller) processLLDPPacket(ingressPort uint32, rawPacket gopacket.Packet) {
+	c.processDiscoveryPacket(ingressPort, packetVLAN(rawPacket), rawPacket, false)
+}
+
+// Processes the LLDP payload of the LLDP or BDDP packet received on the given ingress port and VLAN, updating the
+// corresponding link
+func (c *Controller) processDiscoveryPacket(ingressPort uint32, vlan string, rawPacket gopacket.Packet, bddp bool) {
+	lldp := rawPacket.Layer(layers.LayerTypeLinkLayerDiscovery).(*layers.LinkLayerDiscovery)
+	egressDeviceID, egressPortID := chassisIDString(lldp.ChassisID), portIDString(lldp.PortID)
+	if egressDeviceID == "" || egressPortID == "" {
+		log.Warnf("Ignoring LLDP packet with empty chassis or port ID")
+		return
+	}
+
+	var info *layers.LinkLayerDiscoveryInfo
+	if infoLayer := rawPacket.Layer(layers.LayerTypeLinkLayerDiscoveryInfo); infoLayer != nil {
+		info = infoLayer.(*layers.LinkLayerDiscoveryInfo)
+	}
+	neighbor := decodeNeighbor(lldp, info)
+	key := linkKey{ingressPort: ingressPort, egressDeviceID: egressDeviceID, egressPortID: egressPortID, vlan: vlan}
+
+	// Authenticate the packet unless the policy says otherwise; shutdown requests must be authentic as well
+	policy := c.lldpAuthPolicy()
+	reason := ""
+	if policy != lldpAuthNone {
+		reason = c.authenticateLLDPPacket(key, lldp, info)
+		if reason != "" && policy == lldpAuthReject {
+			log.Warnf("Rejected LLDP packet on port %d from %s/%s: %s authentication", ingressPort, egressDeviceID, egressPortID, reason)
+			return
+		}
+	}
+
+	// TTL of 0 signals that the neighbor is shutting down its port; earlier agents and controllers advertise TTL of 0
+	// on every packet, so only honor it from neighbors that carry our organizationally specific TLVs
+	if neighbor.TTL == 0 && c.honorsLinkTTL() && hasOrgTLVs(info) {
+		c.shutdownLink(key)
+		return
+	}
+
+	c.updateIngressLink(ingressPort, egressPortID, egressDeviceID, vlan)
+	c.updateLinkIndirection(key, bddp)
+	c.updateLinkNeighbor(key, neighbor)
+	c.updateLinkLatency(key, info)
+	c.updateLinkLoss(key, info)
+	c.updateLinkConfirmation(key, info)
+	if policy == lldpAuthFlag {
+		c.updateLinkAuthentication(key, reason == "")
+	}
+}
+
+// Returns true if the TTL advertised by neighbors determines the max age of links
+func (c *Controller) honorsLinkTTL() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.config.LinkTTLMultiplier > 0
+}
+
+// Returns the max age of the given link, derived from the TTL advertised by the neighbor if available, or from the
+// configured max link age otherwise; 0 means the link never expires; must be called with lock held
+func (c *Controller) maxLinkAge(link *Link) time.Duration {
+	if c.config.LinkTTLMultiplier > 0 && link.Neighbor != nil && link.Neighbor.TTL > 0 {
+		return time.Duration(c.config.LinkTTLMultiplier) * time.Duration(link.Neighbor.TTL) * time.Second
+	}
+	if c.config.MaxLinkAge <= 0 {
+		return 0
+	}
+	return time.Duration(c.config.MaxLinkAge) * time.Second
+}
+
+// Removes the given link right away, as requested by the neighbor
+func (c *Controller) shutdownLink(key linkKey) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.links[key]; ok {
+		c.deleteLink(key)
+		log.Infof("Removed link shut down by neighbor: %d <- %s/%s", key.ingressPort, key.egressDeviceID, key.egressPortID)
+	}
+}
@@ -0,0 +1,171 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"github.com/google/gopacket/layers"
+	"time"
+)
+
+const (
+	// Policies for handling LLDP packets that fail authentication
+	lldpAuthNone   = "none"   // packets are not authenticated
+	lldpAuthFlag   = "flag"   // links are discovered, but flagged as not authenticated
+	lldpAuthReject = "reject" // packets are ignored
+
+	// Reasons for failed authentication, used as names of the counters
+	lldpAuthMissing   = "missing"
+	lldpAuthInvalid   = "invalid"
+	lldpAuthReplayed  = "replayed"
+	lldpAuthReflected = "reflected"
+
+	lldpAuthNonceLength  = 8
+	lldpAuthDigestLength = sha256.Size
+	lldpAuthTLVLength    = 8 + lldpAuthNonceLength + lldpAuthDigestLength
+)
+
+// Auxiliary state for authentication of emitted and received LLDP packets
+type lldpAuthState struct {
+	lastEmitted    uint64
+	lastTimestamps map[lldpSender]uint64
+	failures       map[string]int64
+}
+
+// Chassis and port IDs of the agent port that emitted an LLDP packet
+type lldpSender struct {
+	chassisID string
+	portID    string
+}
+
+// Returns the shared key for authentication of LLDP packets; nil if none is configured
+func (c *Controller) lldpAuthKey() []byte {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if len(c.config.LLDPAuthKey) == 0 {
+		return nil
+	}
+	return []byte(c.config.LLDPAuthKey)
+}
+
+// Returns the timestamp for authentication of the next emitted LLDP packet; timestamps strictly increase, so that
+// packets emitted in quick succession, e.g. for several VLANs, are not taken for replays of one another
+func (c *Controller) nextLLDPAuthTimestamp() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	timestamp := uint64(c.now().UnixNano())
+	if timestamp <= c.lldpAuth.lastEmitted {
+		timestamp = c.lldpAuth.lastEmitted + 1
+	}
+	c.lldpAuth.lastEmitted = timestamp
+	return time.Unix(0, int64(timestamp))
+}
+
+// Produces the authentication TLV for the LLDP packet with the given chassis and port IDs
+func newLLDPAuthTLV(key []byte, chassisID []byte, portID []byte, timestamp time.Time) (layers.LinkLayerDiscoveryValue, error) {
+	value := binary.BigEndian.AppendUint64(make([]byte, 0, lldpAuthTLVLength), uint64(timestamp.UnixNano()))
+	nonce := make([]byte, lldpAuthNonceLength)
+	if _, err := rand.Read(nonce); err != nil {
+		return layers.LinkLayerDiscoveryValue{}, err
+	}
+	value = append(value, nonce...)
+	value = append(value, lldpAuthDigest(key, chassisID, portID, value)...)
+	return newOrgTLV(lldpAuthSubtype, value), nil
+}
+
+// Returns HMAC of the given chassis and port IDs, and the timestamp and nonce
+func lldpAuthDigest(key []byte, chassisID []byte, portID []byte, timestampAndNonce []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	for _, field := range [][]byte{chassisID, portID, timestampAndNonce} {
+		// Prefix each field by its length, so that their boundaries cannot be shifted
+		_ = binary.Write(mac, binary.BigEndian, uint16(len(field)))
+		mac.Write(field)
+	}
+	return mac.Sum(nil)
+}
+
+// Returns the policy for handling LLDP packets that fail authentication; unknown policies are treated as reject
+func (c *Controller) lldpAuthPolicy() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	switch c.config.LLDPAuthPolicy {
+	case lldpAuthNone, "":
+		return lldpAuthNone
+	case lldpAuthFlag:
+		return lldpAuthFlag
+	default:
+		return lldpAuthReject
+	}
+}
+
+// Authenticates the given LLDP packet received for the given link, counting any failures; returns empty reason if
+// the packet is authentic, or the reason for its failed authentication
+func (c *Controller) authenticateLLDPPacket(key linkKey, lldp *layers.LinkLayerDiscovery, info *layers.LinkLayerDiscoveryInfo) string {
+	reason := c.verifyLLDPPacket(key, lldp, info)
+	if reason != "" {
+		c.lock.Lock()
+		c.lldpAuth.failures[reason]++
+		c.updateTree(treeLeaf{fmt.Sprintf("state/lldp-auth/%s", reason), intVal(c.lldpAuth.failures[reason])})
+		c.lock.Unlock()
+	}
+	return reason
+}
+
+// Verifies the authentication TLV of the given LLDP packet received for the given link
+func (c *Controller) verifyLLDPPacket(key linkKey, lldp *layers.LinkLayerDiscovery, info *layers.LinkLayerDiscoveryInfo) string {
+	authKey := c.lldpAuthKey()
+	if info == nil || authKey == nil {
+		return lldpAuthMissing
+	}
+
+	value := findOrgTLV(info, lldpAuthSubtype)
+	if len(value) != lldpAuthTLVLength {
+		return lldpAuthMissing
+	}
+
+	timestampAndNonce, digest := value[:8+lldpAuthNonceLength], value[8+lldpAuthNonceLength:]
+	if !hmac.Equal(digest, lldpAuthDigest(authKey, lldp.ChassisID.ID, lldp.PortID.ID, timestampAndNonce)) {
+		return lldpAuthInvalid
+	}
+
+	// Packets carrying our own chassis ID may have been captured and reflected back to us, e.g. by an edge host, which
+	// the replay check cannot detect, as the packets we emit are never recorded there; they are rejected outright, so
+	// links looping back to this device cannot be authenticated
+	if key.egressDeviceID == c.IngressDeviceID {
+		return lldpAuthReflected
+	}
+
+	// Packets must be recent and must not precede the last packet authenticated from the same sender, regardless of
+	// the port or VLAN on which they were received, so that they cannot be replayed elsewhere
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	sender := lldpSender{chassisID: key.egressDeviceID, portID: key.egressPortID}
+	timestamp := binary.BigEndian.Uint64(timestampAndNonce)
+	maxSkew := time.Duration(c.config.LLDPAuthMaxSkew) * time.Second
+	skew := c.now().Sub(time.Unix(0, int64(timestamp)))
+	if skew > maxSkew || skew < -maxSkew || timestamp <= c.lldpAuth.lastTimestamps[sender] {
+		return lldpAuthReplayed
+	}
+	c.lldpAuth.lastTimestamps[sender] = timestamp
+	return ""
+}
+
+// Updates whether the given link has been authenticated, publishing the change
+func (c *Controller) updateLinkAuthentication(key linkKey, authenticated bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	link, ok := c.links[key]
+	if !ok || (link.Authenticated != nil && *link.Authenticated == authenticated) {
+		return
+	}
+	link.Authenticated = &authenticated
+	if !c.isLinkSuppressed(key) {
+		c.updateTree(treeLeaf{c.linkPath(key) + "/authenticated", boolVal(authenticated)})
+	}
+}
@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Produces a pair of controllers sharing the given clock, the second acting as a neighbor of the first
+func newAuthTestControllers(t *testing.T, policy string, key string, neighborKey string) (*Controller, *Controller, *testClock) {
+	c, clock := newTestController(t)
+	c.config.LLDPAuthPolicy = policy
+	c.config.LLDPAuthKey = key
+	neighbor, _ := newTestController(t)
+	neighbor.IngressDeviceID = "foo"
+	neighbor.config.LLDPAuthKey = neighborKey
+	neighbor.now = clock.now
+	return c, neighbor, clock
+}
+
+func authFailures(c *Controller, reason string) int64 {
+	return c.Root().GetPath("state/lldp-auth/" + reason).Value().GetIntVal()
+}
+
+func TestController_LLDPAuthReject(t *testing.T) {
+	c, neighbor, clock := newAuthTestControllers(t, lldpAuthReject, "secret", "secret")
+
+	// Authentic packet should be accepted
+	packet := newAgentLLDPPacket(t, neighbor, 10, 30)
+	c.processLLDPPacket(1, packet)
+	assert.Len(t, c.GetLinks(), 1)
+	assert.Nil(t, c.GetLinks()[0].Authenticated)
+
+	// Replaying it, on the same port or on another one, should be rejected right away...
+	c.processLLDPPacket(1, packet)
+	c.processLLDPPacket(2, packet)
+	assert.Len(t, c.GetLinks(), 1)
+	assert.Equal(t, int64(2), authFailures(c, lldpAuthReplayed))
+
+	// ... as well as after a while, once it is too old
+	clock.advance(time.Minute)
+	c.processLLDPPacket(3, packet)
+	assert.Len(t, c.GetLinks(), 1)
+	assert.Equal(t, int64(3), authFailures(c, lldpAuthReplayed))
+
+	// Packets signed with another key should be rejected
+	neighbor.config.LLDPAuthKey = "guess"
+	c.processLLDPPacket(3, newAgentLLDPPacket(t, neighbor, 30, 30))
+	assert.Equal(t, int64(1), authFailures(c, lldpAuthInvalid))
+
+	// Unsigned packets should be rejected
+	neighbor.config.LLDPAuthKey = ""
+	c.processLLDPPacket(3, newAgentLLDPPacket(t, neighbor, 30, 30))
+	assert.Equal(t, int64(1), authFailures(c, lldpAuthMissing))
+	assert.Len(t, c.GetLinks(), 1)
+
+	// Packets with tampered port ID should be rejected; that includes shutdown requests
+	neighbor.config.LLDPAuthKey = "secret"
+	bytes, err := neighbor.lldpPacket(10, 0, 1)
+	assert.NoError(t, err)
+	packet = gopacket.NewPacket(bytes, layers.LayerTypeEthernet, gopacket.Default)
+	lldp := packet.Layer(layers.LayerTypeLinkLayerDiscovery).(*layers.LinkLayerDiscovery)
+	lldp.PortID.ID = []byte("11")
+	c.processLLDPPacket(1, packet)
+	assert.Equal(t, int64(2), authFailures(c, lldpAuthInvalid))
+
+	lldp.PortID.ID = []byte("10")
+	c.processLLDPPacket(1, packet)
+	assert.Len(t, c.GetLinks(), 0)
+}
+
+func TestController_LLDPAuthFlag(t *testing.T) {
+	c, neighbor, _ := newAuthTestControllers(t, lldpAuthFlag, "secret", "")
+
+	// Unauthenticated links should be discovered, but flagged
+	c.processLLDPPacket(1, newAgentLLDPPacket(t, neighbor, 10, 30))
+	links := c.GetLinks()
+	assert.Len(t, links, 1)
+	assert.False(t, *links[0].Authenticated)
+	path := "state/link[port=1,device=foo,egress-port=10]/authenticated"
+	assert.False(t, c.Root().GetPath(path).Value().GetBoolVal())
+	assert.Equal(t, int64(1), authFailures(c, lldpAuthMissing))
+
+	// ... until the neighbor starts authenticating its packets
+	neighbor.config.LLDPAuthKey = "secret"
+	c.processLLDPPacket(1, newAgentLLDPPacket(t, neighbor, 10, 30))
+	assert.True(t, *c.GetLinks()[0].Authenticated)
+	assert.True(t, c.Root().GetPath(path).Value().GetBoolVal())
+
+	// Flag should be mirrored by standby agents
+	c.updateMastershipInTree(true)
+	_, mirrored, _ := parseInventory(getInventory(t, c))
+	assert.True(t, *mirrored[0].Authenticated)
+}
+
+func TestController_LLDPAuthPolicy(t *testing.T) {
+	c, _ := newTestController(t)
+	assert.Equal(t, lldpAuthNone, c.lldpAuthPolicy())
+	c.config.LLDPAuthPolicy = "bogus"
+	assert.Equal(t, lldpAuthReject, c.lldpAuthPolicy())
+
+	// No packets should be authenticated per the none policy
+	c.config.LLDPAuthPolicy = lldpAuthNone
+	neighbor, _ := newTestController(t)
+	c.processLLDPPacket(1, newAgentLLDPPacket(t, neighbor, 10, 30))
+	assert.Len(t, c.GetLinks(), 1)
+	assert.Equal(t, int64(0), authFailures(c, lldpAuthMissing))
+}
+
+func TestController_LLDPAuthTimestamps(t *testing.T) {
+	c, neighbor, _ := newAuthTestControllers(t, lldpAuthReject, "secret", "secret")
+
+	// Packets emitted without the clock advancing, e.g. tagged for several VLANs, should all be authentic
+	c.processLLDPPacket(1, newAgentLLDPPacket(t, neighbor, 10, 30))
+	c.processDiscoveryPacket(1, "100", newAgentLLDPPacket(t, neighbor, 10, 30), false)
+	c.processDiscoveryPacket(1, "200", newAgentLLDPPacket(t, neighbor, 10, 30), false)
+	assert.Len(t, c.GetLinks(), 3)
+	assert.Equal(t, int64(0), authFailures(c, lldpAuthReplayed))
+}
+
+func TestController_LLDPAuthReflection(t *testing.T) {
+	c, _, _ := newAuthTestControllers(t, lldpAuthReject, "secret", "secret")
+
+	// Our own authentic packet, reflected back to us, should not yield a link, on the same port or on another one
+	packet := newAgentLLDPPacket(t, c, 1, 30)
+	c.processLLDPPacket(1, packet)
+	c.processLLDPPacket(2, packet)
+	assert.Len(t, c.GetLinks(), 0)
+	assert.Equal(t, int64(2), authFailures(c, lldpAuthReflected))
+	assert.Equal(t, int64(0), authFailures(c, lldpAuthReplayed))
+}
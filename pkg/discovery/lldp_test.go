@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/onosproject/onos-net-lib/pkg/packet"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Produces LLDP packet emitted by the given agent on the given port with the given TTL in its next round of probes, as
+// it would be received
+func newAgentLLDPPacket(t *testing.T, agent *Controller, portNumber uint32, ttl uint16) gopacket.Packet {
+	bytes, err := agent.lldpPacket(portNumber, ttl, agent.nextProbeSequence())
+	assert.NoError(t, err)
+	return gopacket.NewPacket(bytes, layers.LayerTypeEthernet, gopacket.Default)
+}
+
+func TestController_LLDPPacket(t *testing.T) {
+	c, _ := newTestController(t)
+	assert.Equal(t, uint16(30), c.lldpTTL())
+	c.config.LLDPTTL = 100000
+	assert.Equal(t, uint16(65535), c.lldpTTL())
+
+	packet := newAgentLLDPPacket(t, c, 3, 120)
+	lldp := packet.Layer(layers.LayerTypeLinkLayerDiscovery).(*layers.LinkLayerDiscovery)
+	assert.Equal(t, "123", chassisIDString(lldp.ChassisID))
+	assert.Equal(t, "3", portIDString(lldp.PortID))
+	assert.Equal(t, uint16(120), lldp.TTL)
+}
+
+func TestController_LinkTTL(t *testing.T) {
+	c, clock := newTestController(t)
+	neighbor, _ := newTestController(t)
+	neighbor.IngressDeviceID = "foo"
+	c.config.MaxLinkAge = 30
+	c.config.LinkTTLMultiplier = 2
+
+	c.processLLDPPacket(1, newAgentLLDPPacket(t, neighbor, 10, 40))
+	c.processLLDPPacket(2, newAgentLLDPPacket(t, neighbor, 20, 10))
+	links := c.GetLinks()
+	assert.Len(t, links, 2)
+	assert.Equal(t, uint16(40), links[0].Neighbor.TTL)
+
+	// Each link should expire after its advertised TTL times the multiplier
+	clock.advance(21 * time.Second)
+	c.pruneLinks()
+	links = c.GetLinks()
+	assert.Len(t, links, 1)
+	assert.Equal(t, uint32(1), links[0].IngressPort)
+
+	clock.advance(40 * time.Second)
+	c.pruneLinks()
+	assert.Len(t, c.GetLinks(), 1)
+	clock.advance(20 * time.Second)
+	c.pruneLinks()
+	assert.Len(t, c.GetLinks(), 0)
+
+	// Without the multiplier, the max link age applies
+	c.config.LinkTTLMultiplier = 0
+	c.processLLDPPacket(1, newAgentLLDPPacket(t, neighbor, 10, 40))
+	clock.advance(31 * time.Second)
+	c.pruneLinks()
+	assert.Len(t, c.GetLinks(), 0)
+}
+
+func TestController_LinkShutdown(t *testing.T) {
+	c, _ := newTestController(t)
+	neighbor, _ := newTestController(t)
+	neighbor.IngressDeviceID = "foo"
+
+	c.processLLDPPacket(1, newAgentLLDPPacket(t, neighbor, 10, 30))
+	assert.Len(t, c.GetLinks(), 1)
+
+	// TTL of 0 should remove the link right away, without penalizing it as a flap
+	c.processLLDPPacket(1, newAgentLLDPPacket(t, neighbor, 10, 0))
+	assert.Len(t, c.GetLinks(), 0)
+	assert.Nil(t, c.Root().GetPath("state/link[port=1,device=foo,egress-port=10]"))
+	assert.Len(t, c.flaps, 0)
+
+	// ... and should not create one either
+	c.processLLDPPacket(1, newAgentLLDPPacket(t, neighbor, 10, 0))
+	assert.Len(t, c.GetLinks(), 0)
+
+	// Unless TTL is disregarded, as when neighbors running older versions advertise TTL of 0
+	c.config.LinkTTLMultiplier = 0
+	c.processLLDPPacket(1, newAgentLLDPPacket(t, neighbor, 10, 0))
+	assert.Len(t, c.GetLinks(), 1)
+}
+
+func TestController_LegacyLinkTTL(t *testing.T) {
+	c, _ := newTestController(t)
+
+	// Packets from earlier agents carry TTL of 0 and none of our TLVs, yet must not be treated as a shutdown
+	bytes, err := packet.ControllerLLDPPacket("foo", 10)
+	assert.NoError(t, err)
+	legacy := gopacket.NewPacket(bytes, layers.LayerTypeEthernet, gopacket.Default)
+	assert.Equal(t, uint16(0), legacy.Layer(layers.LayerTypeLinkLayerDiscovery).(*layers.LinkLayerDiscovery).TTL)
+
+	c.processLLDPPacket(1, legacy)
+	assert.Len(t, c.GetLinks(), 1)
+	c.processLLDPPacket(1, legacy)
+	assert.Len(t, c.GetLinks(), 1)
+	assert.NotNil(t, c.Root().GetPath("state/link[port=1,device=foo,egress-port=10]"))
+}
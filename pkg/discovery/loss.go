@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"github.com/google/gopacket/layers"
+	"math/bits"
+	"time"
+)
+
+const (
+	// Number of most recently expected probes over which the loss ratio of a link is computed
+	lossWindow = 64
+
+	// Minimum number of expected probes before a link can be considered degraded
+	minLossWindow = 8
+)
+
+// Records receipt of the probe with the given sequence number, accounting for any probes missed since the last one
+func (l *Link) recordProbe(sequence uint32) {
+	gap := int64(1)
+	if l.ProbesReceived > 0 {
+		// Same sequence means the probe has been received via both LLDP and BDDP; only the first one counts
+		if sequence == l.lastSequence {
+			return
+		}
+		// Sequence going backwards, or skipping more than the whole window, means the neighbor restarted; accounting
+		// simply resumes from the received probe
+		if gap = int64(int32(sequence - l.lastSequence)); gap <= 0 || gap > lossWindow {
+			gap = 1
+		}
+	}
+	// Shifting by the full width clears the bitmap, as all probes within the window were missed
+	l.recentProbes = l.recentProbes<<uint64(gap) | 1
+	if l.recentCount += gap; l.recentCount > lossWindow {
+		l.recentCount = lossWindow
+	}
+	l.lastSequence = sequence
+	l.ProbesExpected += gap
+	l.ProbesReceived++
+}
+
+// Returns the ratio of probes lost among the most recently expected ones, presuming the given number of pending probes,
+// i.e. those expected since the last received one, to be lost as well; also returns the number of probes considered
+func (l *Link) lossRatio(pending int64) (float64, int64) {
+	window := l.recentCount + pending
+	if window > lossWindow {
+		window = lossWindow
+	}
+	if window == 0 {
+		return 0, 0
+	}
+	received := bits.OnesCount64(l.recentProbes << uint64(pending))
+	return 1 - float64(received)/float64(window), window
+}
+
+// Returns true if the given loss ratio, computed over the given number of probes, exceeds the configured threshold
+func (c *Controller) isLossDegraded(ratio float64, window int64) bool {
+	threshold := c.config.LinkLossThreshold
+	return threshold > 0 && window >= minLossWindow && ratio*100 > float64(threshold)
+}
+
+// Records the probe carried by the LLDP packet received for the given link and publishes its loss statistics
+func (c *Controller) updateLinkLoss(key linkKey, info *layers.LinkLayerDiscoveryInfo) {
+	_, sequence, ok := parseProbeTLV(info)
+	if !ok {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	link, ok := c.links[key]
+	if !ok {
+		return
+	}
+	link.recordProbe(sequence)
+	ratio, window := link.lossRatio(0)
+	link.Degraded = c.isLossDegraded(ratio, window)
+
+	if !c.isLinkSuppressed(key) {
+		c.updateTree(lossLeaves(c.linkPath(key), link, ratio)...)
+	}
+}
+
+// Marks links degraded whose loss, counting probes that should have arrived since their last update, exceeds the
+// configured threshold, without waiting for the links to expire; the neighbors are presumed to emit probes at the
+// same frequency as this agent; must be called with lock held
+func (c *Controller) degradeLinks() {
+	if c.config.LinkLossThreshold <= 0 || c.config.EmitFrequency <= 0 {
+		return
+	}
+	interval := time.Duration(c.config.EmitFrequency) * time.Second
+	now := c.now()
+	for key, link := range c.links {
+		if link.ProbesReceived == 0 || link.Degraded {
+			continue
+		}
+		// Probe that is just due is given the benefit of the doubt
+		pending := int64(now.Sub(link.LastUpdate)/interval) - 1
+		if pending <= 0 {
+			continue
+		}
+		if ratio, window := link.lossRatio(pending); c.isLossDegraded(ratio, window) {
+			link.Degraded = true
+			log.Infof("Link degraded due to missed probes: %d <- %s/%s", link.IngressPort, link.EgressDeviceID, link.EgressPortID)
+			if !c.isLinkSuppressed(key) {
+				c.updateTree(lossLeaves(c.linkPath(key), link, ratio)...)
+			}
+		}
+	}
+}
+
+// Returns the config tree leaves of the loss statistics of the given link
+func lossLeaves(path string, link *Link, ratio float64) []treeLeaf {
+	return []treeLeaf{
+		{path + "/loss-ratio", doubleVal(ratio)},
+		{path + "/expected-probes", intVal(link.ProbesExpected)},
+		{path + "/received-probes", intVal(link.ProbesReceived)},
+		{path + "/missed-probes", intVal(link.ProbesExpected - link.ProbesReceived)},
+		{path + "/degraded", boolVal(link.Degraded)},
+	}
+}
@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLink_RecordProbe(t *testing.T) {
+	link := &Link{}
+	link.recordProbe(5)
+	link.recordProbe(6)
+	link.recordProbe(9)
+	assert.Equal(t, int64(5), link.ProbesExpected)
+	assert.Equal(t, int64(3), link.ProbesReceived)
+	ratio, window := link.lossRatio(0)
+	assert.Equal(t, 0.4, ratio)
+	assert.Equal(t, int64(5), window)
+
+	// Pending probes should be presumed lost
+	ratio, window = link.lossRatio(5)
+	assert.Equal(t, 0.7, ratio)
+	assert.Equal(t, int64(10), window)
+
+	// Neighbor restart should not count as loss
+	link.recordProbe(1)
+	assert.Equal(t, int64(6), link.ProbesExpected)
+	assert.Equal(t, int64(4), link.ProbesReceived)
+
+	// Loss ratio should only reflect the most recent probes
+	for seq := uint32(2); seq < 2+lossWindow; seq++ {
+		link.recordProbe(seq)
+	}
+	ratio, window = link.lossRatio(0)
+	assert.Equal(t, 0.0, ratio)
+	assert.Equal(t, int64(lossWindow), window)
+
+	// Gap spanning the whole window should count as loss of all but the received probe
+	link.recordProbe(1 + 2*lossWindow)
+	ratio, _ = link.lossRatio(0)
+	assert.Equal(t, float64(lossWindow-1)/lossWindow, ratio)
+
+	// Larger gap means the neighbor restarted, and should not count as loss either
+	expected := link.ProbesExpected
+	link.recordProbe(1000)
+	assert.Equal(t, expected+1, link.ProbesExpected)
+	ratio, _ = link.lossRatio(0)
+	assert.Equal(t, float64(lossWindow-2)/lossWindow, ratio)
+}
+
+func TestController_LinkLoss(t *testing.T) {
+	c, clock := newTestController(t)
+	neighbor, _ := newTestController(t)
+	neighbor.IngressDeviceID = "foo"
+	c.config.LinkLossThreshold = 20
+	path := "state/link[port=1,device=foo,egress-port=10]"
+
+	// Every third probe is lost
+	for i := 0; i < 12; i++ {
+		if i%3 == 1 {
+			neighbor.nextProbeSequence()
+			continue
+		}
+		c.processLLDPPacket(1, newAgentLLDPPacket(t, neighbor, 10, 30))
+	}
+	link := c.GetLinks()[0]
+	assert.Equal(t, int64(12), link.ProbesExpected)
+	assert.Equal(t, int64(8), link.ProbesReceived)
+	assert.True(t, link.Degraded)
+	assert.Equal(t, int64(4), c.Root().GetPath(path+"/missed-probes").Value().GetIntVal())
+	assert.InDelta(t, 1.0/3, c.Root().GetPath(path+"/loss-ratio").Value().GetDoubleVal(), 1e-9)
+	assert.True(t, c.Root().GetPath(path+"/degraded").Value().GetBoolVal())
+
+	// Link should recover once probes are received again
+	for i := 0; i < 30; i++ {
+		c.processLLDPPacket(1, newAgentLLDPPacket(t, neighbor, 10, 30))
+	}
+	assert.False(t, c.GetLinks()[0].Degraded)
+	assert.False(t, c.Root().GetPath(path+"/degraded").Value().GetBoolVal())
+
+	// Link whose neighbor went silent should be degraded before it expires
+	c.config.MaxLinkAge = 300
+	c.config.LinkTTLMultiplier = 0
+	clock.advance(10 * time.Second)
+	c.pruneLinks()
+	assert.False(t, c.GetLinks()[0].Degraded)
+	clock.advance(25 * time.Second)
+	c.pruneLinks()
+	assert.True(t, c.GetLinks()[0].Degraded)
+	assert.True(t, c.Root().GetPath(path+"/degraded").Value().GetBoolVal())
+}
@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"net"
+)
+
+// Returns true if hosts are to be learned from IPv6 neighbor discovery messages
+func (c *Controller) learnsIPv6Hosts() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.config.IPv6HostLearning
+}
+
+// Returns the ICMPv6 types of the neighbor discovery messages from which hosts are learned
+func (c *Controller) ndpICMPTypes() []uint8 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	types := []uint8{layers.ICMPv6TypeNeighborSolicitation, layers.ICMPv6TypeNeighborAdvertisement}
+	if c.config.RouterSolicitationLearning {
+		types = append(types, layers.ICMPv6TypeRouterSolicitation)
+	}
+	return types
+}
+
+// Learns the host binding advertised by the neighbor discovery message carried by the given packet, if any
+func (c *Controller) processNDPPacket(ingressPort uint32, rawPacket gopacket.Packet) {
+	ethLayer, ipLayer := rawPacket.Layer(layers.LayerTypeEthernet), rawPacket.Layer(layers.LayerTypeIPv6)
+	if ethLayer == nil || ipLayer == nil || !c.learnsIPv6Hosts() {
+		return
+	}
+	mac, ip := ethLayer.(*layers.Ethernet).SrcMAC, ipLayer.(*layers.IPv6).SrcIP
+
+	// Addresses are bound to the link-layer address option, if any, rather than to the source MAC
+	switch {
+	case rawPacket.Layer(layers.LayerTypeICMPv6NeighborSolicitation) != nil:
+		ns := rawPacket.Layer(layers.LayerTypeICMPv6NeighborSolicitation).(*layers.ICMPv6NeighborSolicitation)
+		mac = linkLayerAddress(ns.Options, layers.ICMPv6OptSourceAddress, mac)
+	case rawPacket.Layer(layers.LayerTypeICMPv6NeighborAdvertisement) != nil:
+		na := rawPacket.Layer(layers.LayerTypeICMPv6NeighborAdvertisement).(*layers.ICMPv6NeighborAdvertisement)
+		mac, ip = linkLayerAddress(na.Options, layers.ICMPv6OptTargetAddress, mac), na.TargetAddress
+	case rawPacket.Layer(layers.LayerTypeICMPv6RouterSolicitation) != nil && c.learnsFromRouterSolicitations():
+		rs := rawPacket.Layer(layers.LayerTypeICMPv6RouterSolicitation).(*layers.ICMPv6RouterSolicitation)
+		mac = linkLayerAddress(rs.Options, layers.ICMPv6OptSourceAddress, mac)
+	default:
+		return
+	}
+
+	// Duplicate address detection uses the unspecified address, which is not bound to the host
+	if ip.IsUnspecified() || ip.IsMulticast() {
+		return
+	}
+	c.learnHost(hostKey{mac: mac.String(), vlan: packetVLAN(rawPacket)}, ip.String(), ingressPort, ndpSource)
+}
+
+// Returns true if hosts are to be learned from router solicitations as well
+func (c *Controller) learnsFromRouterSolicitations() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.config.RouterSolicitationLearning
+}
+
+// Returns the link-layer address carried by the option of the given type, or the given default if there is none
+func linkLayerAddress(options layers.ICMPv6Options, optionType layers.ICMPv6Opt, defaultMAC net.HardwareAddr) net.HardwareAddr {
+	for _, option := range options {
+		if option.Type == optionType && len(option.Data) == 6 {
+			return option.Data
+		}
+	}
+	return defaultMAC
+}
@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+// Produces ICMPv6 packet with the given source addresses, carrying the given neighbor discovery message
+func newNDPPacket(t *testing.T, mac string, ip string, icmpType uint8, message gopacket.SerializableLayer) gopacket.Packet {
+	srcMAC, _ := net.ParseMAC(mac)
+	eth := &layers.Ethernet{
+		SrcMAC:       srcMAC,
+		DstMAC:       net.HardwareAddr{0x33, 0x33, 0xff, 0x00, 0x00, 0x01},
+		EthernetType: layers.EthernetTypeIPv6,
+	}
+	ip6 := &layers.IPv6{
+		Version:    6,
+		SrcIP:      net.ParseIP(ip),
+		DstIP:      net.ParseIP("ff02::1:ff00:1"),
+		NextHeader: layers.IPProtocolICMPv6,
+		HopLimit:   255,
+	}
+	icmp := &layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(icmpType, 0)}
+	assert.NoError(t, icmp.SetNetworkLayerForChecksum(ip6))
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	assert.NoError(t, gopacket.SerializeLayers(buf, opts, eth, ip6, icmp, message))
+	return gopacket.NewPacket(buf.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+}
+
+func TestController_NDPHostLearning(t *testing.T) {
+	c, clock := newTestController(t)
+	mac := "00:00:00:00:00:01"
+	routerMAC := []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x02}
+
+	// Nothing is learned unless enabled
+	c.processNDPPacket(3, newNDPPacket(t, mac, "2001:db8::1", layers.ICMPv6TypeNeighborSolicitation,
+		&layers.ICMPv6NeighborSolicitation{TargetAddress: net.ParseIP("2001:db8::ff")}))
+	assert.Len(t, c.hosts, 0)
+	c.config.IPv6HostLearning = true
+
+	// Solicitation binds its source address
+	c.processNDPPacket(3, newNDPPacket(t, mac, "2001:db8::1", layers.ICMPv6TypeNeighborSolicitation,
+		&layers.ICMPv6NeighborSolicitation{TargetAddress: net.ParseIP("2001:db8::ff")}))
+	assert.Len(t, c.hosts, 1)
+	assert.Equal(t, []string{"2001:db8::1"}, c.hosts[hostKey{mac: mac}].IPs)
+	assert.Equal(t, "ipv6", c.Root().GetPath("state/host[mac=00:00:00:00:00:01]/ip[address=2001:db8::1]/family").Value().GetStringVal())
+
+	// Advertisement binds its target address to the target link-layer address
+	c.processNDPPacket(4, newNDPPacket(t, mac, "fe80::2", layers.ICMPv6TypeNeighborAdvertisement,
+		&layers.ICMPv6NeighborAdvertisement{
+			TargetAddress: net.ParseIP("2001:db8::2"),
+			Options:       layers.ICMPv6Options{{Type: layers.ICMPv6OptTargetAddress, Data: routerMAC}},
+		}))
+	assert.Len(t, c.hosts, 2)
+	assert.Equal(t, []string{"2001:db8::2"}, c.hosts[hostKey{mac: "00:00:00:00:00:02"}].IPs)
+
+	// Duplicate address detection does not bind any address
+	c.processNDPPacket(3, newNDPPacket(t, mac, "::", layers.ICMPv6TypeNeighborSolicitation,
+		&layers.ICMPv6NeighborSolicitation{TargetAddress: net.ParseIP("2001:db8::3")}))
+	assert.Equal(t, []string{"2001:db8::1"}, c.hosts[hostKey{mac: mac}].IPs)
+
+	// Router solicitations are learned only if enabled
+	rs := &layers.ICMPv6RouterSolicitation{}
+	c.processNDPPacket(3, newNDPPacket(t, mac, "fe80::1", layers.ICMPv6TypeRouterSolicitation, rs))
+	assert.Equal(t, []string{"2001:db8::1"}, c.hosts[hostKey{mac: mac}].IPs)
+	c.config.RouterSolicitationLearning = true
+	c.processNDPPacket(3, newNDPPacket(t, mac, "fe80::1", layers.ICMPv6TypeRouterSolicitation, rs))
+	assert.Equal(t, []string{"2001:db8::1", "fe80::1"}, c.hosts[hostKey{mac: mac}].IPs)
+
+	// Dual-stack host retains all its addresses, each aging out independently
+	c.config.MaxHostAge = 60
+	clock.advance(40 * time.Second)
+	c.updateHost(hostKey{mac: mac}, "10.0.0.1", 3)
+	assert.Equal(t, []string{"10.0.0.1", "2001:db8::1", "fe80::1"}, c.hosts[hostKey{mac: mac}].IPs)
+	assert.Equal(t, "ipv4", c.Root().GetPath("state/host[mac=00:00:00:00:00:01]/ip[address=10.0.0.1]/family").Value().GetStringVal())
+	assert.Equal(t, "10.0.0.1", c.Root().GetPath("state/host[mac=00:00:00:00:00:01]/ip-address").Value().GetStringVal())
+
+	clock.advance(30 * time.Second)
+	c.pruneHosts()
+	assert.Equal(t, []string{"10.0.0.1"}, c.hosts[hostKey{mac: mac}].IPs)
+	assert.Nil(t, c.Root().GetPath("state/host[mac=00:00:00:00:00:01]/ip[address=fe80::1]/family"))
+	assert.Len(t, c.hosts, 1)
+
+	// Moved host learns its addresses anew
+	c.updateHost(hostKey{mac: mac}, "2001:db8::1", 5)
+	assert.Equal(t, []string{"2001:db8::1"}, c.hosts[hostKey{mac: mac}].IPs)
+	assert.Equal(t, int64(5), c.Root().GetPath("state/host[mac=00:00:00:00:00:01]/port").Value().GetIntVal())
+	assert.Nil(t, c.Root().GetPath("state/host[mac=00:00:00:00:00:01]/ip[address=10.0.0.1]/family"))
+
+	// Nothing is learned once disabled
+	c.config.IPv6HostLearning = false
+	c.processNDPPacket(6, newNDPPacket(t, "00:00:00:00:00:03", "2001:db8::3", layers.ICMPv6TypeNeighborSolicitation,
+		&layers.ICMPv6NeighborSolicitation{TargetAddress: net.ParseIP("2001:db8::ff")}))
+	assert.Len(t, c.hosts, 1)
+}
@@ -0,0 +1,275 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"fmt"
+	"github.com/google/gopacket/layers"
+	"github.com/onosproject/onos-net-lib/pkg/packet"
+	"github.com/openconfig/gnmi/proto/gnmi"
+	"net"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Neighbor holds details about the egress device of an ingress link, as advertised in its LLDP packets
+type Neighbor struct {
+	// Raw chassis and port IDs, as hex strings, along with the names of their subtypes
+	ChassisIDSubtype string
+	ChassisID        string
+	PortIDSubtype    string
+	PortID           string
+
+	TTL                 uint16
+	PortDescription     string
+	SystemName          string
+	SystemDescription   string
+	SystemCapabilities  string // comma-separated list of capability names
+	EnabledCapabilities string // comma-separated list of capability names
+	ManagementAddress   string
+
+	// IEEE 802.1 organizationally specific details
+	PortVLANID        uint16
+	ManagementVLANID  uint16
+	VLANNames         string // comma-separated list of id:name pairs
+	AggregationPortID uint32 // 0 if the port is not aggregated
+
+	// IEEE 802.3 organizationally specific details
+	AutoNegotiation bool
+	MAUType         uint16
+	MTU             uint16
+}
+
+// Decodes the neighbor details from the given LLDP layers; the info layer may be nil
+func decodeNeighbor(lldp *layers.LinkLayerDiscovery, info *layers.LinkLayerDiscoveryInfo) *Neighbor {
+	neighbor := &Neighbor{
+		ChassisIDSubtype: lldp.ChassisID.Subtype.String(),
+		ChassisID:        fmt.Sprintf("%x", lldp.ChassisID.ID),
+		PortIDSubtype:    lldp.PortID.Subtype.String(),
+		PortID:           fmt.Sprintf("%x", lldp.PortID.ID),
+		TTL:              lldp.TTL,
+	}
+	if info == nil {
+		return neighbor
+	}
+
+	neighbor.PortDescription = info.PortDescription
+	neighbor.SystemName = info.SysName
+	neighbor.SystemDescription = info.SysDescription
+	neighbor.SystemCapabilities = capabilityNames(info.SysCapabilities.SystemCap)
+	neighbor.EnabledCapabilities = capabilityNames(info.SysCapabilities.EnabledCap)
+	neighbor.ManagementAddress = managementAddress(info.MgmtAddress)
+
+	// Decoders return the details gathered up to the first malformed TLV, which are worth keeping
+	info8021, err := info.Decode8021()
+	if err != nil {
+		log.Debugf("Unable to fully decode 802.1 TLVs: %+v", err)
+	}
+	neighbor.PortVLANID = info8021.PVID
+	neighbor.ManagementVLANID = info8021.ManagementVID
+	vlanNames := make([]string, 0, len(info8021.VLANNames))
+	for _, vlan := range info8021.VLANNames {
+		vlanNames = append(vlanNames, fmt.Sprintf("%d:%s", vlan.ID, vlan.Name))
+	}
+	neighbor.VLANNames = strings.Join(vlanNames, ",")
+
+	info8023, err := info.Decode8023()
+	if err != nil {
+		log.Debugf("Unable to fully decode 802.3 TLVs: %+v", err)
+	}
+	neighbor.AutoNegotiation = info8023.MACPHYConfigStatus.AutoNegEnabled
+	neighbor.MAUType = info8023.MACPHYConfigStatus.MAUType
+	neighbor.MTU = info8023.MTU
+
+	// Link aggregation was moved from 802.3 to 802.1 TLV; accept either
+	if info8021.LinkAggregation.Enabled {
+		neighbor.AggregationPortID = info8021.LinkAggregation.PortID
+	} else if info8023.LinkAggregation.Enabled {
+		neighbor.AggregationPortID = info8023.LinkAggregation.PortID
+	}
+	return neighbor
+}
+
+// Returns the string form of the given chassis ID, which serves as the egress device ID of links
+func chassisIDString(id layers.LLDPChassisID) string {
+	switch id.Subtype {
+	case layers.LLDPChassisIDSubTypeMACAddr:
+		return macAddressString(id.ID)
+	case layers.LLDPChassisIDSubTypeNetworkAddr:
+		return networkAddressString(id.ID)
+	default:
+		return printableString(id.ID)
+	}
+}
+
+// Returns the string form of the given port ID, which serves as the egress port ID of links
+func portIDString(id layers.LLDPPortID) string {
+	switch id.Subtype {
+	case layers.LLDPPortIDSubtypeMACAddr:
+		return macAddressString(id.ID)
+	case layers.LLDPPortIDSubtypeNetworkAddr:
+		return networkAddressString(id.ID)
+	default:
+		return printableString(id.ID)
+	}
+}
+
+// Returns the numeric form of the given port ID, if it has one; 0 otherwise
+func numericPortID(portID string) uint32 {
+	number, err := strconv.ParseUint(portID, 10, 32)
+	if err != nil {
+		return 0
+	}
+	return uint32(number)
+}
+
+// Returns the given MAC address in its usual form, or as a hex string if it is not a MAC address
+func macAddressString(addr []byte) string {
+	if len(addr) != 6 {
+		return fmt.Sprintf("%x", addr)
+	}
+	return packet.MACString(addr)
+}
+
+// Returns the given network address, prefixed by its IANA address family, in its usual form for IP addresses, or as
+// a hex string otherwise
+func networkAddressString(addr []byte) string {
+	if len(addr) > 1 {
+		family, ip := layers.IANAAddressFamily(addr[0]), addr[1:]
+		if (family == layers.IANAAddressFamilyIPV4 && len(ip) == net.IPv4len) ||
+			(family == layers.IANAAddressFamilyIPV6 && len(ip) == net.IPv6len) {
+			return net.IP(ip).String()
+		}
+	}
+	return fmt.Sprintf("%x", addr)
+}
+
+// Returns the given bytes as a string if they are printable, or as a hex string otherwise
+func printableString(value []byte) string {
+	if !utf8.Valid(value) {
+		return fmt.Sprintf("%x", value)
+	}
+	for _, r := range string(value) {
+		if !unicode.IsPrint(r) {
+			return fmt.Sprintf("%x", value)
+		}
+	}
+	return string(value)
+}
+
+// Returns comma-separated names of the given capabilities
+func capabilityNames(caps layers.LLDPCapabilities) string {
+	names := make([]string, 0)
+	for _, c := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"other", caps.Other}, {"repeater", caps.Repeater}, {"bridge", caps.Bridge}, {"wlan-ap", caps.WLANAP},
+		{"router", caps.Router}, {"phone", caps.Phone}, {"docsis", caps.DocSis}, {"station", caps.StationOnly},
+		{"c-vlan", caps.CVLAN}, {"s-vlan", caps.SVLAN}, {"tpmr", caps.TMPR},
+	} {
+		if c.enabled {
+			names = append(names, c.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// Returns the string form of the given management address
+func managementAddress(addr layers.LLDPMgmtAddress) string {
+	switch {
+	case len(addr.Address) == 0:
+		return ""
+	case addr.Subtype == layers.IANAAddressFamilyIPV4 || addr.Subtype == layers.IANAAddressFamilyIPV6:
+		return net.IP(addr.Address).String()
+	case addr.Subtype == layers.IANAAddressFamily802:
+		return packet.MACString(addr.Address)
+	default:
+		return fmt.Sprintf("%x", addr.Address)
+	}
+}
+
+// Updates the neighbor details of the given link, publishing them if they changed
+func (c *Controller) updateLinkNeighbor(key linkKey, neighbor *Neighbor) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	link, ok := c.links[key]
+	if !ok || (link.Neighbor != nil && *link.Neighbor == *neighbor) {
+		return
+	}
+	link.Neighbor = neighbor
+	if !c.isLinkSuppressed(key) {
+		c.updateTree(neighborLeaves(c.linkPath(key), neighbor)...)
+	}
+}
+
+// Returns the config tree leaves of the given neighbor details of the link at the given path
+func neighborLeaves(linkPath string, neighbor *Neighbor) []treeLeaf {
+	path := linkPath + "/neighbor/"
+	return []treeLeaf{
+		{path + "chassis-id-subtype", stringVal(neighbor.ChassisIDSubtype)},
+		{path + "chassis-id", stringVal(neighbor.ChassisID)},
+		{path + "port-id-subtype", stringVal(neighbor.PortIDSubtype)},
+		{path + "port-id", stringVal(neighbor.PortID)},
+		{path + "ttl", uintVal(uint64(neighbor.TTL))},
+		{path + "port-description", stringVal(neighbor.PortDescription)},
+		{path + "system-name", stringVal(neighbor.SystemName)},
+		{path + "system-description", stringVal(neighbor.SystemDescription)},
+		{path + "system-capabilities", stringVal(neighbor.SystemCapabilities)},
+		{path + "enabled-capabilities", stringVal(neighbor.EnabledCapabilities)},
+		{path + "management-address", stringVal(neighbor.ManagementAddress)},
+		{path + "port-vlan-id", uintVal(uint64(neighbor.PortVLANID))},
+		{path + "management-vlan-id", uintVal(uint64(neighbor.ManagementVLANID))},
+		{path + "vlan-names", stringVal(neighbor.VLANNames)},
+		{path + "aggregation-port-id", uintVal(uint64(neighbor.AggregationPortID))},
+		{path + "auto-negotiation", boolVal(neighbor.AutoNegotiation)},
+		{path + "mau-type", uintVal(uint64(neighbor.MAUType))},
+		{path + "mtu", uintVal(uint64(neighbor.MTU))},
+	}
+}
+
+// Sets the neighbor detail with the given config tree leaf name to the given value
+func setNeighborLeaf(neighbor *Neighbor, name string, value *gnmi.TypedValue) {
+	switch name {
+	case "chassis-id-subtype":
+		neighbor.ChassisIDSubtype = value.GetStringVal()
+	case "chassis-id":
+		neighbor.ChassisID = value.GetStringVal()
+	case "port-id-subtype":
+		neighbor.PortIDSubtype = value.GetStringVal()
+	case "port-id":
+		neighbor.PortID = value.GetStringVal()
+	case "ttl":
+		neighbor.TTL = uint16(value.GetUintVal())
+	case "port-description":
+		neighbor.PortDescription = value.GetStringVal()
+	case "system-name":
+		neighbor.SystemName = value.GetStringVal()
+	case "system-description":
+		neighbor.SystemDescription = value.GetStringVal()
+	case "system-capabilities":
+		neighbor.SystemCapabilities = value.GetStringVal()
+	case "enabled-capabilities":
+		neighbor.EnabledCapabilities = value.GetStringVal()
+	case "management-address":
+		neighbor.ManagementAddress = value.GetStringVal()
+	case "port-vlan-id":
+		neighbor.PortVLANID = uint16(value.GetUintVal())
+	case "management-vlan-id":
+		neighbor.ManagementVLANID = uint16(value.GetUintVal())
+	case "vlan-names":
+		neighbor.VLANNames = value.GetStringVal()
+	case "aggregation-port-id":
+		neighbor.AggregationPortID = uint32(value.GetUintVal())
+	case "auto-negotiation":
+		neighbor.AutoNegotiation = value.GetBoolVal()
+	case "mau-type":
+		neighbor.MAUType = uint16(value.GetUintVal())
+	case "mtu":
+		neighbor.MTU = uint16(value.GetUintVal())
+	}
+}
@@ -0,0 +1,167 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+// Produces an LLDP packet, as would be sent by lldpd running on a server
+func newThirdPartyLLDPPacket(t *testing.T) gopacket.Packet {
+	mgmtAddress := append([]byte{5, byte(layers.IANAAddressFamilyIPV4)}, net.ParseIP("10.0.0.42").To4()...)
+	mgmtAddress = append(mgmtAddress, byte(layers.LLDPInterfaceSubtypeifIndex), 0, 0, 0, 2, 0)
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+		DstMAC:       net.HardwareAddr{0x01, 0x80, 0xc2, 0x00, 0x00, 0x0e},
+		EthernetType: layers.EthernetTypeLinkLayerDiscovery,
+	}
+	lldp := &layers.LinkLayerDiscovery{
+		ChassisID: layers.LLDPChassisID{Subtype: layers.LLDPChassisIDSubTypeLocal, ID: []byte("server1")},
+		PortID:    layers.LLDPPortID{Subtype: layers.LLDPPortIDSubtypeLocal, ID: []byte("7")},
+		TTL:       120,
+		Values: []layers.LinkLayerDiscoveryValue{
+			{Type: layers.LLDPTLVPortDescription, Value: []byte("eth0")},
+			{Type: layers.LLDPTLVSysName, Value: []byte("server1.example.com")},
+			{Type: layers.LLDPTLVSysDescription, Value: []byte("Ubuntu 22.04")},
+			{Type: layers.LLDPTLVSysCapabilities, Value: []byte{0, 0x14, 0, 0x10}},
+			{Type: layers.LLDPTLVMgmtAddress, Value: mgmtAddress},
+			{Type: layers.LLDPTLVOrgSpecific, Value: []byte{0x00, 0x80, 0xc2, layers.LLDP8021SubtypePortVLANID, 0, 100}},
+			{Type: layers.LLDPTLVOrgSpecific, Value: []byte{0x00, 0x80, 0xc2, layers.LLDP8021SubtypeLinkAggregation, 0x03, 0, 0, 0, 9}},
+			{Type: layers.LLDPTLVOrgSpecific, Value: []byte{0x00, 0x12, 0x0f, layers.LLDP8023SubtypeMTU, 0x23, 0x28}},
+			{Type: layers.LLDPTLVOrgSpecific, Value: []byte{0x00, 0x12, 0x0f, layers.LLDP8023SubtypeMACPHY, 0x03, 0x6c, 0x01, 0x00, 0x1e}},
+		},
+	}
+	for i := range lldp.Values {
+		lldp.Values[i].Length = uint16(len(lldp.Values[i].Value))
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	assert.NoError(t, gopacket.SerializeLayers(buf, gopacket.SerializeOptions{}, eth, lldp))
+	return gopacket.NewPacket(buf.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+}
+
+func TestDecodeNeighbor(t *testing.T) {
+	packet := newThirdPartyLLDPPacket(t)
+	lldp := packet.Layer(layers.LayerTypeLinkLayerDiscovery).(*layers.LinkLayerDiscovery)
+	info := packet.Layer(layers.LayerTypeLinkLayerDiscoveryInfo).(*layers.LinkLayerDiscoveryInfo)
+
+	neighbor := decodeNeighbor(lldp, info)
+	assert.Equal(t, uint16(120), neighbor.TTL)
+	assert.Equal(t, "eth0", neighbor.PortDescription)
+	assert.Equal(t, "server1.example.com", neighbor.SystemName)
+	assert.Equal(t, "Ubuntu 22.04", neighbor.SystemDescription)
+	assert.Equal(t, "bridge,router", neighbor.SystemCapabilities)
+	assert.Equal(t, "router", neighbor.EnabledCapabilities)
+	assert.Equal(t, "10.0.0.42", neighbor.ManagementAddress)
+	assert.Equal(t, uint16(100), neighbor.PortVLANID)
+	assert.Equal(t, uint32(9), neighbor.AggregationPortID)
+	assert.Equal(t, uint16(9000), neighbor.MTU)
+	assert.True(t, neighbor.AutoNegotiation)
+	assert.Equal(t, uint16(30), neighbor.MAUType)
+
+	assert.Equal(t, "Local", neighbor.ChassisIDSubtype)
+	assert.Equal(t, "73657276657231", neighbor.ChassisID)
+	assert.Equal(t, "Local", neighbor.PortIDSubtype)
+	assert.Equal(t, "37", neighbor.PortID)
+
+	// Only the mandatory TLVs are available without the info layer
+	neighbor = decodeNeighbor(lldp, nil)
+	assert.Equal(t, uint16(120), neighbor.TTL)
+	assert.Equal(t, "37", neighbor.PortID)
+	assert.Equal(t, "", neighbor.SystemName)
+}
+
+func TestChassisAndPortIDs(t *testing.T) {
+	mac := []byte{0x00, 0x11, 0x22, 0xaa, 0xbb, 0xcc}
+	assert.Equal(t, "00:11:22:aa:bb:cc", chassisIDString(layers.LLDPChassisID{Subtype: layers.LLDPChassisIDSubTypeMACAddr, ID: mac}))
+	assert.Equal(t, "10.1.2.3", chassisIDString(layers.LLDPChassisID{Subtype: layers.LLDPChassisIDSubTypeNetworkAddr, ID: []byte{1, 10, 1, 2, 3}}))
+	assert.Equal(t, "switch1", chassisIDString(layers.LLDPChassisID{Subtype: layers.LLDPChassisIDSubTypeChassisComp, ID: []byte("switch1")}))
+	assert.Equal(t, "0001ff", chassisIDString(layers.LLDPChassisID{Subtype: layers.LLDPChassisIDSubTypeLocal, ID: []byte{0, 1, 0xff}}))
+
+	assert.Equal(t, "00:11:22:aa:bb:cc", portIDString(layers.LLDPPortID{Subtype: layers.LLDPPortIDSubtypeMACAddr, ID: mac}))
+	assert.Equal(t, "fd00::1", portIDString(layers.LLDPPortID{Subtype: layers.LLDPPortIDSubtypeNetworkAddr,
+		ID: append([]byte{2}, net.ParseIP("fd00::1")...)}))
+	assert.Equal(t, "Ethernet1/1", portIDString(layers.LLDPPortID{Subtype: layers.LLDPPortIDSubtypeIfaceName, ID: []byte("Ethernet1/1")}))
+	assert.Equal(t, "0a0b", portIDString(layers.LLDPPortID{Subtype: layers.LLDPPortIDSubtypeMACAddr, ID: []byte{10, 11}}))
+
+	assert.Equal(t, uint32(7), numericPortID("7"))
+	assert.Equal(t, uint32(0), numericPortID("eth0"))
+}
+
+func TestController_NonNumericEgressPort(t *testing.T) {
+	c, _ := newTestController(t)
+	c.updateIngressLink(1, "Ethernet1/1", "00:11:22:aa:bb:cc", "")
+	c.updateIngressLink(2, "7", "foo", "")
+
+	links := c.GetLinks()
+	assert.Len(t, links, 2)
+	assert.Equal(t, "Ethernet1/1", links[0].EgressPortID)
+	assert.Equal(t, uint32(0), links[0].EgressPort)
+	assert.Equal(t, uint32(7), links[1].EgressPort)
+
+	// Port IDs with characters reserved in paths should be escaped in the key, but not in the leaf value
+	path := "state/link[port=1,device=00:11:22:aa:bb:cc,egress-port=Ethernet1%2F1]"
+	assert.Equal(t, "Ethernet1/1", c.Root().GetPath(path+"/egress-port-id").Value().GetStringVal())
+	assert.Nil(t, c.Root().GetPath(path+"/egress-port"))
+	assert.Equal(t, int64(7), c.Root().GetPath("state/link[port=2,device=foo,egress-port=7]/egress-port").Value().GetIntVal())
+
+	// Such links should be mirrored intact
+	c.updateMastershipInTree(true)
+	_, mirrored, _ := parseInventory(getInventory(t, c))
+	assert.Len(t, mirrored, 2)
+	for _, link := range mirrored {
+		if link.IngressPort == 1 {
+			assert.Equal(t, "Ethernet1/1", link.EgressPortID)
+			assert.Equal(t, "00:11:22:aa:bb:cc", link.EgressDeviceID)
+		} else {
+			assert.Equal(t, "7", link.EgressPortID)
+		}
+	}
+
+	c.lock.Lock()
+	c.withdrawLink(links[0].key())
+	c.lock.Unlock()
+	assert.Nil(t, c.Root().GetPath(path))
+	assert.NotNil(t, c.Root().GetPath("state/link-dampening[port=1,device=00:11:22:aa:bb:cc,egress-port=Ethernet1%2F1]/flaps"))
+}
+
+func TestController_UpdateLinkNeighbor(t *testing.T) {
+	c, _ := newTestController(t)
+	packet := newThirdPartyLLDPPacket(t)
+	lldp := packet.Layer(layers.LayerTypeLinkLayerDiscovery).(*layers.LinkLayerDiscovery)
+	info := packet.Layer(layers.LayerTypeLinkLayerDiscoveryInfo).(*layers.LinkLayerDiscoveryInfo)
+	key := linkKey{ingressPort: 1, egressDeviceID: "server1", egressPortID: "7"}
+
+	// Neighbor details of unknown links should be ignored
+	c.updateLinkNeighbor(key, decodeNeighbor(lldp, info))
+	assert.Nil(t, c.Root().GetPath("state/link[port=1,device=server1,egress-port=7]"))
+
+	c.updateIngressLink(1, "7", "server1", "")
+	c.updateLinkNeighbor(key, decodeNeighbor(lldp, info))
+	path := "state/link[port=1,device=server1,egress-port=7]/neighbor/"
+	assert.Equal(t, "server1.example.com", c.Root().GetPath(path+"system-name").Value().GetStringVal())
+	assert.Equal(t, "10.0.0.42", c.Root().GetPath(path+"management-address").Value().GetStringVal())
+	assert.Equal(t, uint64(9000), c.Root().GetPath(path+"mtu").Value().GetUintVal())
+
+	// Unchanged details should not be re-published
+	responder := &testResponder{}
+	c.AddSubscribeResponder(responder)
+	c.updateLinkNeighbor(key, decodeNeighbor(lldp, info))
+	assert.Len(t, responder.responses, 0)
+
+	// Neighbor details should be mirrored by standby agents
+	c.updateMastershipInTree(true)
+	_, links, _ := parseInventory(getInventory(t, c))
+	assert.Len(t, links, 1)
+	assert.Equal(t, *decodeNeighbor(lldp, info), *links[0].Neighbor)
+
+	s, _ := newTestController(t)
+	s.mirrorInventory(links, nil)
+	assert.Equal(t, "server1.example.com", s.Root().GetPath(path+"system-name").Value().GetStringVal())
+}
@@ -26,12 +26,14 @@ type portMonitor struct {
 
 func (c *Controller) discoverPorts() {
 	log.Infof("Discovering ports...")
-	resp, err := c.gnmiClient.Get(c.ctx, &gnmi.GetRequest{
+	ctx, cancel := c.requestContext(c.ctx)
+	resp, err := c.gnmiClient.Get(ctx, &gnmi.GetRequest{
 		Path: []*gnmi.Path{gnmiutils.ToPath("interfaces/interface[name=...]/state")},
 	})
+	cancel()
 	if err != nil {
 		log.Warn("Unable to issue gNMI request for port list: %+v", err)
-		c.setStateIf(Elected, Disconnected)
+		c.setStateIf(Elected, Disconnected, "unable to discover ports")
 		return
 	}
 	if len(resp.Notification) == 0 {
@@ -54,13 +56,14 @@ func (c *Controller) discoverPorts() {
 	}
 
 	c.lock.Lock()
+	c.updatePortsInTree(c.ports, ports)
 	c.ports = ports
 
 	// Once ports are discovered kick off a port-status monitor, if necessary
 	c.monitor.start(c, len(ports))
 	c.lock.Unlock()
 
-	c.setStateIf(Elected, PortsDiscovered)
+	c.setStateIf(Elected, PortsDiscovered, "ports discovered")
 
 	log.Infof("Ports discovered")
 }
@@ -75,6 +78,31 @@ func getPort(ports map[string]*Port, id string) *Port {
 	return port
 }
 
+// Reconciles the ports in the config tree with the newly discovered ports, forwarding the additions, updates
+// and deletions to any subscribe responders; must be called with lock held
+func (c *Controller) updatePortsInTree(oldPorts map[string]*Port, newPorts map[string]*Port) {
+	for id, old := range oldPorts {
+		if port, ok := newPorts[id]; !ok || port.Number != old.Number {
+			log.Infof("Port %s/%d removed", old.ID, old.Number)
+			c.deleteFromTree(fmt.Sprintf("state/port[number=%d]", old.Number))
+		}
+	}
+	for id, port := range newPorts {
+		if old, ok := oldPorts[id]; !ok || *old != *port {
+			c.addPortToTree(port)
+		}
+	}
+}
+
+// Adds or updates the given port in the config tree and forwards the update to any subscribe responders
+func (c *Controller) addPortToTree(port *Port) {
+	c.updateTree(
+		treeLeaf{fmt.Sprintf("state/port[number=%d]/name", port.Number), stringVal(port.ID)},
+		treeLeaf{fmt.Sprintf("state/port[number=%d]/oper-status", port.Number), stringVal(port.Status)},
+		treeLeaf{fmt.Sprintf("state/port[number=%d]/last-change", port.Number), uintVal(port.LastChange)},
+	)
+}
+
 // Starts the port monitor if not already started and if the given port change stamp is newer
 func (m *portMonitor) start(c *Controller, portCount int) {
 	if m.ctxCancel == nil || m.portCount != portCount {
@@ -107,7 +135,7 @@ func (m *portMonitor) monitorPortStatus(c *Controller) {
 	subscriptions := make([]*gnmi.Subscription, 0, len(c.ports))
 	for key := range c.ports {
 		subscriptions = append(subscriptions, &gnmi.Subscription{
-			Path: gnmiutils.ToPath(fmt.Sprintf("interfaces/interface[name=%s]/state/oper-state", key)),
+			Path: gnmiutils.ToPath(fmt.Sprintf("interfaces/interface[name=%s]/state/oper-status", key)),
 		})
 	}
 	if err = stream.Send(&gnmi.SubscribeRequest{
@@ -138,14 +166,30 @@ func (m *portMonitor) monitorPortStatus(c *Controller) {
 	}
 }
 
-// If the given port status changes from UP to DOWN, delete any associated link
+// If the given port status changes from UP to DOWN, withdraw any associated links
 func (c *Controller) processPortStatusUpdate(portKey string, newPortStatus string) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	port := getPort(c.ports, portKey)
+	port, ok := c.ports[portKey]
+	if !ok {
+		log.Warnf("Ignoring status update for unknown port %s", portKey)
+		return
+	}
 	if port.Status == portUp && newPortStatus == portDown {
-		log.Infof("Deleting any ingress link for port %d", port.Number)
-		c.deleteLink(port.Number)
+		log.Infof("Withdrawing any ingress links for port %d", port.Number)
+		for key := range c.links {
+			if key.ingressPort == port.Number {
+				c.withdrawLink(key)
+			}
+		}
+		for key := range c.echoes {
+			if key.ingressPort == port.Number {
+				delete(c.echoes, key)
+			}
+		}
+	}
+	if port.Status != newPortStatus {
+		port.Status = newPortStatus
+		c.updateTree(treeLeaf{fmt.Sprintf("state/port[number=%d]/oper-status", port.Number), stringVal(newPortStatus)})
 	}
-	port.Status = newPortStatus
 }
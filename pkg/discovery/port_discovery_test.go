@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"context"
+	"errors"
+	"github.com/openconfig/gnmi/proto/gnmi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"testing"
+)
+
+// Fake gNMI client that responds to get requests with canned port state
+type fakePortsClient struct {
+	gnmi.GNMIClient
+	updates []*gnmi.Update
+}
+
+func (f *fakePortsClient) Get(ctx context.Context, in *gnmi.GetRequest, opts ...grpc.CallOption) (*gnmi.GetResponse, error) {
+	return &gnmi.GetResponse{Notification: []*gnmi.Notification{{Update: f.updates}}}, nil
+}
+
+func (f *fakePortsClient) Subscribe(ctx context.Context, opts ...grpc.CallOption) (gnmi.GNMI_SubscribeClient, error) {
+	return nil, errors.New("not supported")
+}
+
+// Sets the canned port state
+func (f *fakePortsClient) setPorts(ports ...*Port) {
+	f.updates = nil
+	for _, port := range ports {
+		f.updates = append(f.updates,
+			&gnmi.Update{Path: portStatePath(port.ID, "id"), Val: uintVal(uint64(port.Number))},
+			&gnmi.Update{Path: portStatePath(port.ID, "oper-status"), Val: stringVal(port.Status)},
+			&gnmi.Update{Path: portStatePath(port.ID, "last-change"), Val: uintVal(port.LastChange)},
+		)
+	}
+}
+
+// Returns path of the given port state leaf; built explicitly, since port names contain slashes
+func portStatePath(name string, leaf string) *gnmi.Path {
+	return &gnmi.Path{Elem: []*gnmi.PathElem{
+		{Name: "interfaces"},
+		{Name: "interface", Key: map[string]string{"name": name}},
+		{Name: "state"},
+		{Name: leaf},
+	}}
+}
+
+func TestController_DiscoverPorts(t *testing.T) {
+	c, _ := newTestController(t)
+	c.ctx = context.Background()
+	client := &fakePortsClient{}
+	c.gnmiClient = client
+	responder := &testResponder{}
+	c.AddSubscribeResponder(responder)
+
+	client.setPorts(&Port{ID: "1/1", Number: 1, Status: portUp, LastChange: 100},
+		&Port{ID: "2/1", Number: 2, Status: portDown, LastChange: 200})
+	c.discoverPorts()
+	assert.Equal(t, "1/1", c.Root().GetPath("state/port[number=1]/name").Value().GetStringVal())
+	assert.Equal(t, portUp, c.Root().GetPath("state/port[number=1]/oper-status").Value().GetStringVal())
+	assert.Equal(t, uint64(100), c.Root().GetPath("state/port[number=1]/last-change").Value().GetUintVal())
+	assert.Equal(t, portDown, c.Root().GetPath("state/port[number=2]/oper-status").Value().GetStringVal())
+	assert.Len(t, responder.responses, 2)
+
+	// Rediscovery of the same ports should not produce any notifications
+	c.discoverPorts()
+	assert.Len(t, responder.responses, 2)
+
+	// Port 2 changed status, port 1 got removed and port 3 got added
+	client.setPorts(&Port{ID: "2/1", Number: 2, Status: portUp, LastChange: 300},
+		&Port{ID: "3/1", Number: 3, Status: portUp, LastChange: 400})
+	c.discoverPorts()
+	assert.Nil(t, c.Root().GetPath("state/port[number=1]"))
+	assert.Equal(t, portUp, c.Root().GetPath("state/port[number=2]/oper-status").Value().GetStringVal())
+	assert.Equal(t, uint64(300), c.Root().GetPath("state/port[number=2]/last-change").Value().GetUintVal())
+	assert.Equal(t, "3/1", c.Root().GetPath("state/port[number=3]/name").Value().GetStringVal())
+	assert.Len(t, responder.responses, 5)
+}
+
+func TestController_ProcessPortStatusUpdate(t *testing.T) {
+	c, _ := newTestController(t)
+	c.ctx = context.Background()
+	client := &fakePortsClient{}
+	c.gnmiClient = client
+	client.setPorts(&Port{ID: "1/1", Number: 1, Status: portUp, LastChange: 100})
+	c.discoverPorts()
+	c.updateIngressLink(1, "10", "foo", "")
+
+	c.processPortStatusUpdate("1/1", portDown)
+	assert.Equal(t, portDown, c.Root().GetPath("state/port[number=1]/oper-status").Value().GetStringVal())
+	assert.Len(t, c.GetLinks(), 0)
+
+	c.processPortStatusUpdate("9/9", portDown)
+	assert.Len(t, c.ports, 1)
+}
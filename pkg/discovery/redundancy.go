@@ -0,0 +1,289 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"context"
+	"github.com/onosproject/onos-net-lib/pkg/gnmiutils"
+	"github.com/openconfig/gnmi/proto/gnmi"
+	"google.golang.org/grpc"
+	"strconv"
+	"time"
+)
+
+const (
+	mastershipPath = "state/mastership"
+	primary        = "primary"
+	standby        = "standby"
+
+	peerRequestTimeout = 2 * time.Second
+)
+
+// Stands by as a backup, keeping the link and host inventory up to date by mirroring it from the primary peer;
+// returns on any state change or reconfiguration
+func (c *Controller) waitInStandby() {
+	c.lock.RLock()
+	tMirror := newTicker(c.config.EmitFrequency)
+	tPrune := newTicker(c.config.LinkPruneFrequency)
+	c.lock.RUnlock()
+
+	defer tMirror.Stop()
+	defer tPrune.Stop()
+
+	for c.getState() == Standby {
+		select {
+		// Periodically mirror the inventory of the primary peer
+		case <-tMirror.C:
+			c.mirrorPrimaryInventory()
+
+		// Periodically prune links and hosts; mirroring refreshes the ones still present on the primary
+		case <-tPrune.C:
+			c.pruneLinks()
+			c.pruneHosts()
+
+		case <-c.stateChanged:
+			return
+		}
+	}
+}
+
+// Updates the mastership leaf in the config tree and forwards the change to any subscribe responders
+func (c *Controller) updateMastershipInTree(isPrimary bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	value := standby
+	if isPrimary {
+		value = primary
+	}
+	if node := c.Root().GetPath(mastershipPath); node != nil && node.Value().GetStringVal() == value {
+		return
+	}
+
+	c.updateTree(treeLeaf{mastershipPath, stringVal(value)})
+}
+
+// Finds the peer agent that is presently the primary and mirrors its link and host inventory
+func (c *Controller) mirrorPrimaryInventory() {
+	current := make(map[string]bool)
+	for _, address := range c.PeerAddresses {
+		current[address] = true
+	}
+	c.closePeerConns(current)
+
+	for _, address := range c.PeerAddresses {
+		client, err := c.peerClient(address)
+		if err != nil {
+			log.Warnf("Unable to connect to peer agent at %s: %+v", address, err)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(c.ctx, peerRequestTimeout)
+		resp, err := client.Get(ctx, &gnmi.GetRequest{
+			Path: []*gnmi.Path{
+				gnmiutils.ToPath(mastershipPath),
+				gnmiutils.ToPath("state/link[port=...]"),
+				gnmiutils.ToPath("state/link[port=...,device=...,egress-port=...]"),
+				gnmiutils.ToPath("state/link[port=...,device=...,egress-port=...,vlan=...]"),
+				gnmiutils.ToPath("state/host[mac=...]"),
+				gnmiutils.ToPath("state/host[mac=...,vlan=...]"),
+			},
+		})
+		cancel()
+		if err != nil {
+			log.Warnf("Unable to get inventory from peer agent at %s: %+v", address, err)
+			continue
+		}
+
+		if isPrimary, links, hosts := parseInventory(resp.Notification); isPrimary {
+			c.mirrorInventory(links, hosts)
+			return
+		}
+	}
+}
+
+// Returns gNMI client for the peer agent at the given address, connecting to it if necessary; peers are connected
+// to using the TLS parameters of our own gNMI service, as that is how they serve gNMI too, and with the bearer token
+// from the peer token file, if given, for peers that require authentication
+func (c *Controller) peerClient(address string) (gnmi.GNMIClient, error) {
+	c.lock.RLock()
+	conn, ok := c.peerConns[address]
+	c.lock.RUnlock()
+	if !ok {
+		creds, err := c.peerTransportCredentials()
+		if err != nil {
+			return nil, err
+		}
+		opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+		if len(c.PeerTokenPath) > 0 {
+			opts = append(opts, grpc.WithPerRPCCredentials(&tokenCredentials{tokenPath: c.PeerTokenPath}))
+		}
+		if conn, err = grpc.Dial(address, opts...); err != nil {
+			return nil, err
+		}
+		c.lock.Lock()
+		c.peerConns[address] = conn
+		c.lock.Unlock()
+	}
+	return gnmi.NewGNMIClient(conn), nil
+}
+
+// Closes the connections to peer agents other than the given ones
+func (c *Controller) closePeerConns(keep map[string]bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for address, conn := range c.peerConns {
+		if !keep[address] {
+			_ = conn.Close()
+			delete(c.peerConns, address)
+		}
+	}
+}
+
+// Extracts the mastership status and the link and host inventory from the given gNMI notifications
+func parseInventory(notifications []*gnmi.Notification) (bool, []*Link, []*Host) {
+	isPrimary := false
+	links := make(map[string]*Link)
+	hosts := make(map[hostKey]*Host)
+	legacyIPs := make(map[hostKey]string)
+	for _, notification := range notifications {
+		for _, update := range notification.Update {
+			elems := update.Path.Elem
+			switch {
+			case len(elems) == 2 && elems[1].Name == "mastership":
+				isPrimary = update.Val.GetStringVal() == primary
+			case len(elems) >= 3 && elems[1].Name == "link":
+				// Links may be published under either the legacy or the per-neighbor paths
+				key := gnmiutils.ToString(&gnmi.Path{Elem: elems[1:2]})
+				link, ok := links[key]
+				if !ok {
+					port, err := strconv.ParseUint(elems[1].Key["port"], 10, 32)
+					if err != nil {
+						continue
+					}
+					link = &Link{IngressPort: uint32(port), VLAN: elems[1].Key["vlan"]}
+					links[key] = link
+				}
+				switch {
+				case len(elems) == 3 && elems[2].Name == "egress-port-id":
+					link.EgressPortID = update.Val.GetStringVal()
+				case len(elems) == 3 && elems[2].Name == "egress-port":
+					link.EgressPort = uint32(update.Val.GetIntVal())
+				case len(elems) == 3 && elems[2].Name == "egress-device":
+					link.EgressDeviceID = update.Val.GetStringVal()
+				case len(elems) == 3 && elems[2].Name == "authenticated":
+					authenticated := update.Val.GetBoolVal()
+					link.Authenticated = &authenticated
+				case len(elems) == 3 && elems[2].Name == "bidirectional":
+					bidirectional := update.Val.GetBoolVal()
+					link.Bidirectional = &bidirectional
+				case len(elems) == 3 && elems[2].Name == "indirect":
+					indirect := update.Val.GetBoolVal()
+					link.Indirect = &indirect
+				case len(elems) == 4 && elems[2].Name == "neighbor":
+					if link.Neighbor == nil {
+						link.Neighbor = &Neighbor{}
+					}
+					setNeighborLeaf(link.Neighbor, elems[3].Name, update.Val)
+				}
+			case len(elems) >= 3 && elems[1].Name == "host":
+				key := hostKey{mac: elems[1].Key["mac"], vlan: elems[1].Key["vlan"]}
+				host, ok := hosts[key]
+				if !ok {
+					host = &Host{MAC: key.mac, VLAN: key.vlan, addresses: make(map[string]time.Time)}
+					hosts[key] = host
+				}
+				switch {
+				case len(elems) == 3 && elems[2].Name == "port":
+					host.Port = uint32(update.Val.GetIntVal())
+				case len(elems) == 3 && elems[2].Name == "ip-address":
+					legacyIPs[key] = update.Val.GetStringVal()
+				case len(elems) == 4 && elems[2].Name == "ip":
+					host.addresses[elems[2].Key["address"]] = time.Time{}
+				case len(elems) == 4 && elems[2].Name == "dhcp":
+					if host.Lease == nil {
+						host.Lease = &DHCPLease{}
+					}
+					setLeaseLeaf(host.Lease, elems[3].Name, update.Val)
+				}
+			}
+		}
+	}
+
+	linkList := make([]*Link, 0, len(links))
+	for _, link := range links {
+		// Peers running older versions publish only the numeric egress port
+		if link.EgressPortID == "" {
+			link.EgressPortID = strconv.FormatUint(uint64(link.EgressPort), 10)
+		}
+		linkList = append(linkList, link)
+	}
+	hostList := make([]*Host, 0, len(hosts))
+	for key, host := range hosts {
+		// Peers running older versions publish only a single IP address
+		if ip, ok := legacyIPs[key]; ok && len(host.addresses) == 0 {
+			host.addresses[ip] = time.Time{}
+		}
+		host.IPs = sortedAddresses(host.addresses)
+		hostList = append(hostList, host)
+	}
+	return isPrimary, linkList, hostList
+}
+
+// Replaces our link and host inventory with the given mirrored inventory
+func (c *Controller) mirrorInventory(links []*Link, hosts []*Host) {
+	mirroredLinks := make(map[linkKey]bool)
+	for _, link := range links {
+		c.updateIngressLink(link.IngressPort, link.EgressPortID, link.EgressDeviceID, link.VLAN)
+		if link.Neighbor != nil {
+			c.updateLinkNeighbor(link.key(), link.Neighbor)
+		}
+		if link.Authenticated != nil {
+			c.updateLinkAuthentication(link.key(), *link.Authenticated)
+		}
+		if link.Bidirectional != nil {
+			c.setLinkBidirectional(link.key(), *link.Bidirectional)
+		}
+		if link.Indirect != nil {
+			c.setLinkIndirect(link.key(), *link.Indirect)
+		}
+		mirroredLinks[link.key()] = true
+	}
+	mirroredHosts := make(map[hostKey]map[string]bool)
+	mirroredLeases := make(map[hostKey]bool)
+	for _, host := range hosts {
+		mirroredHosts[host.key()] = make(map[string]bool)
+		for _, ip := range host.IPs {
+			c.updateHost(host.key(), ip, host.Port)
+			mirroredHosts[host.key()][ip] = true
+		}
+		if host.Lease != nil {
+			c.updateHostLease(host.key(), host.Lease)
+			mirroredLeases[host.key()] = true
+		}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for key := range c.links {
+		if !mirroredLinks[key] {
+			c.deleteLink(key)
+		}
+	}
+	for key, host := range c.hosts {
+		mirroredIPs, ok := mirroredHosts[key]
+		if !ok {
+			c.deleteHost(key)
+			continue
+		}
+		for _, ip := range host.IPs {
+			if !mirroredIPs[ip] {
+				c.deleteHostAddress(host, ip)
+			}
+		}
+		if host.Lease != nil && !mirroredLeases[key] {
+			c.forgetHostLease(host)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"github.com/onosproject/onos-net-lib/pkg/gnmiutils"
+	"github.com/openconfig/gnmi/proto/gnmi"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Returns the inventory notifications of the given controller, as they would be returned via gNMI get
+func getInventory(t *testing.T, c *Controller) []*gnmi.Notification {
+	notifications, err := c.ProcessConfigGet(nil, []*gnmi.Path{
+		gnmiutils.ToPath(mastershipPath),
+		gnmiutils.ToPath("state/link[port=...]"),
+		gnmiutils.ToPath("state/link[port=...,device=...,egress-port=...]"),
+		gnmiutils.ToPath("state/link[port=...,device=...,egress-port=...,vlan=...]"),
+		gnmiutils.ToPath("state/host[mac=...]"),
+		gnmiutils.ToPath("state/host[mac=...,vlan=...]"),
+	})
+	assert.NoError(t, err)
+	return notifications
+}
+
+func TestParseInventory(t *testing.T) {
+	c, _ := newTestController(t)
+	c.updateMastershipInTree(true)
+	c.updateIngressLink(1, "10", "foo", "")
+	c.updateIngressLink(2, "20", "bar", "")
+	c.updateHost(hostKey{mac: "00:00:00:00:00:01"}, "10.0.0.1", 3)
+	c.updateHost(hostKey{mac: "00:00:00:00:00:01"}, "2001:db8::1", 3)
+
+	isPrimary, links, hosts := parseInventory(getInventory(t, c))
+	assert.True(t, isPrimary)
+	assert.Len(t, links, 2)
+	for _, link := range links {
+		assert.Equal(t, link.IngressPort*10, link.EgressPort)
+	}
+	assert.Len(t, hosts, 1)
+	assert.Equal(t, []string{"10.0.0.1", "2001:db8::1"}, hosts[0].IPs)
+	assert.Equal(t, uint32(3), hosts[0].Port)
+
+	c.updateMastershipInTree(false)
+	isPrimary, _, _ = parseInventory(getInventory(t, c))
+	assert.False(t, isPrimary)
+}
+
+func TestController_MirrorInventory(t *testing.T) {
+	p, _ := newTestController(t)
+	p.updateMastershipInTree(true)
+	p.updateIngressLink(1, "10", "foo", "")
+	p.updateHost(hostKey{mac: "00:00:00:00:00:01"}, "10.0.0.1", 3)
+	lease := &DHCPLease{Address: "10.0.0.1", Server: "10.0.0.254", Duration: time.Minute, Expiry: time.Unix(1060, 0)}
+	p.updateHostLease(hostKey{mac: "00:00:00:00:00:01"}, lease)
+
+	s, _ := newTestController(t)
+	s.updateIngressLink(2, "20", "bar", "")
+	s.updateHost(hostKey{mac: "00:00:00:00:00:02"}, "10.0.0.2", 4)
+
+	_, links, hosts := parseInventory(getInventory(t, p))
+	s.mirrorInventory(links, hosts)
+
+	mirroredLinks := s.GetLinks()
+	assert.Len(t, mirroredLinks, 1)
+	assert.Equal(t, "foo", mirroredLinks[0].EgressDeviceID)
+	assert.Nil(t, s.Root().GetPath("state/link[port=2,device=bar,egress-port=20]"))
+	assert.NotNil(t, s.Root().GetPath("state/link[port=1,device=foo,egress-port=10]"))
+
+	assert.Len(t, s.hosts, 1)
+	assert.NotNil(t, s.hosts[hostKey{mac: "00:00:00:00:00:01"}])
+	assert.True(t, lease.equal(s.hosts[hostKey{mac: "00:00:00:00:00:01"}].Lease))
+	assert.Nil(t, s.Root().GetPath("state/host[mac=00:00:00:00:00:02]"))
+}
+
+func TestParseInventory_LegacyLinkPaths(t *testing.T) {
+	c, _ := newTestController(t)
+	c.config.LegacyLinkPaths = true
+	c.updateMastershipInTree(true)
+	c.updateIngressLink(1, "10", "foo", "")
+	c.updateIngressLink(2, "20", "bar", "")
+
+	_, links, _ := parseInventory(getInventory(t, c))
+	assert.Len(t, links, 2)
+	for _, link := range links {
+		assert.Equal(t, link.IngressPort*10, link.EgressPort)
+	}
+}
+
+func TestController_PeerConns(t *testing.T) {
+	c, _ := newTestController(t)
+	c.PeerNoTLS = true
+	for _, address := range []string{"127.0.0.1:1", "127.0.0.1:2"} {
+		_, err := c.peerClient(address)
+		assert.NoError(t, err)
+	}
+	assert.Len(t, c.peerConns, 2)
+
+	// Connections to peers no longer configured are closed, as are all on stop
+	c.closePeerConns(map[string]bool{"127.0.0.1:1": true})
+	assert.Len(t, c.peerConns, 1)
+	c.Stop()
+	assert.Empty(t, c.peerConns)
+}
@@ -0,0 +1,167 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/onosproject/onos-lib-go/pkg/certs"
+	"github.com/onosproject/onos-lib-go/pkg/errors"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLSConfig contains parameters for securing the connection to the Stratum agent or to any peer agents
+type TLSConfig struct {
+	CACertPath string `mapstructure:"caCertPath" yaml:"caCertPath"`
+	CertPath   string `mapstructure:"certPath" yaml:"certPath"`
+	KeyPath    string `mapstructure:"keyPath" yaml:"keyPath"`
+	ServerName string `mapstructure:"serverName" yaml:"serverName"`
+}
+
+// Enabled returns true if the configuration calls for use of TLS
+func (t TLSConfig) Enabled() bool {
+	return len(t.CACertPath) > 0 || len(t.CertPath) > 0 || len(t.KeyPath) > 0
+}
+
+// Auxiliary state for loading client certificate and key, and reloading them when they get rotated
+type certLoader struct {
+	lock     sync.Mutex
+	certPath string
+	keyPath  string
+	cert     *tls.Certificate
+	certMod  time.Time
+	keyMod   time.Time
+}
+
+// Returns the client certificate, (re)loading it from files if they changed since the last load
+func (l *certLoader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	certInfo, err := os.Stat(l.certPath)
+	if err != nil {
+		return nil, err
+	}
+	keyInfo, err := os.Stat(l.keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if l.cert == nil || !certInfo.ModTime().Equal(l.certMod) || !keyInfo.ModTime().Equal(l.keyMod) {
+		cert, err := tls.LoadX509KeyPair(l.certPath, l.keyPath)
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("Loaded client certificate %s", l.certPath)
+		l.cert = &cert
+		l.certMod = certInfo.ModTime()
+		l.keyMod = keyInfo.ModTime()
+	}
+	return l.cert, nil
+}
+
+// Returns transport credentials per the TLS configuration; the CA bundle is re-read each time, while the client
+// certificate is reloaded during handshake whenever it changes; server name is used only if override is requested
+func (c *Controller) transportCredentials(overrideServerName bool) (credentials.TransportCredentials, error) {
+	if !c.TargetTLS.Enabled() {
+		return insecure.NewCredentials(), nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if overrideServerName {
+		tlsConfig.ServerName = c.TargetTLS.ServerName
+	}
+
+	if len(c.TargetTLS.CACertPath) > 0 {
+		pem, err := os.ReadFile(c.TargetTLS.CACertPath)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.NewInvalid("no certificates found in CA bundle %s", c.TargetTLS.CACertPath)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if len(c.TargetTLS.CertPath) > 0 || len(c.TargetTLS.KeyPath) > 0 {
+		c.lock.Lock()
+		c.certLoader = reuseCertLoader(c.certLoader, c.TargetTLS)
+		tlsConfig.GetClientCertificate = c.certLoader.getClientCertificate
+		c.lock.Unlock()
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// Returns transport credentials for connecting to the gNMI service of peer agents, per the TLS parameters of our own
+// gNMI service; as with our own service, the default ONF CA and client certificate are used unless given
+func (c *Controller) peerTransportCredentials() (credentials.TransportCredentials, error) {
+	if c.PeerNoTLS {
+		return insecure.NewCredentials(), nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	var err error
+	if len(c.PeerTLS.CACertPath) > 0 {
+		tlsConfig.RootCAs, err = certs.GetCertPool(c.PeerTLS.CACertPath)
+	} else {
+		tlsConfig.RootCAs, err = certs.GetCertPoolDefault()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(c.PeerTLS.CertPath) > 0 || len(c.PeerTLS.KeyPath) > 0 {
+		c.lock.Lock()
+		c.peerCertLoader = reuseCertLoader(c.peerCertLoader, c.PeerTLS)
+		tlsConfig.GetClientCertificate = c.peerCertLoader.getClientCertificate
+		c.lock.Unlock()
+	} else {
+		cert, err := tls.X509KeyPair([]byte(certs.DefaultClientCrt), []byte(certs.DefaultClientKey))
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// Returns the given certificate loader if it loads the certificate and key given by the TLS parameters; otherwise
+// returns a new one that does
+func reuseCertLoader(loader *certLoader, config TLSConfig) *certLoader {
+	if loader == nil || loader.certPath != config.CertPath || loader.keyPath != config.KeyPath {
+		return &certLoader{certPath: config.CertPath, keyPath: config.KeyPath}
+	}
+	return loader
+}
+
+// Per-RPC credentials carrying the JWT bearer token read from the given file; the file is re-read for each call, so
+// that the token can be refreshed without restarting the agent
+type tokenCredentials struct {
+	tokenPath string
+}
+
+// GetRequestMetadata returns the authorization header carrying the bearer token
+func (t *tokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	b, err := os.ReadFile(t.tokenPath)
+	if err != nil {
+		return nil, err
+	}
+	token := strings.TrimSpace(string(b))
+	if len(token) == 0 {
+		return nil, errors.NewInvalid("no bearer token found in %s", t.tokenPath)
+	}
+	return map[string]string{"authorization": "Bearer " + token}, nil
+}
+
+// RequireTransportSecurity returns true, as the bearer token must not be sent in the clear
+func (t *tokenCredentials) RequireTransportSecurity() bool {
+	return true
+}
@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Writes a new self-signed certificate and its key into the given files
+func writeTestCert(t *testing.T, certPath string, keyPath string, serial int64) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "discovery-agent"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+}
+
+func TestCertLoader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "client.crt")
+	keyPath := filepath.Join(dir, "client.key")
+	writeTestCert(t, certPath, keyPath, 1)
+
+	loader := &certLoader{certPath: certPath, keyPath: keyPath}
+	cert1, err := loader.getClientCertificate(nil)
+	assert.NoError(t, err)
+	cert2, err := loader.getClientCertificate(nil)
+	assert.NoError(t, err)
+	assert.Same(t, cert1, cert2)
+
+	// Rotate the certificate and make sure the modification times differ
+	writeTestCert(t, certPath, keyPath, 2)
+	later := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(certPath, later, later))
+	assert.NoError(t, os.Chtimes(keyPath, later, later))
+
+	cert3, err := loader.getClientCertificate(nil)
+	assert.NoError(t, err)
+	assert.NotSame(t, cert1, cert3)
+	leaf, err := x509.ParseCertificate(cert3.Certificate[0])
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), leaf.SerialNumber.Int64())
+}
+
+func TestController_TransportCredentials(t *testing.T) {
+	c, _ := newTestController(t)
+	creds, err := c.transportCredentials(true)
+	assert.NoError(t, err)
+	assert.Equal(t, "insecure", creds.Info().SecurityProtocol)
+
+	dir := t.TempDir()
+	c.TargetTLS = TLSConfig{
+		CACertPath: filepath.Join(dir, "ca.crt"),
+		CertPath:   filepath.Join(dir, "client.crt"),
+		KeyPath:    filepath.Join(dir, "client.key"),
+		ServerName: "stratum",
+	}
+	_, err = c.transportCredentials(true)
+	assert.Error(t, err)
+
+	writeTestCert(t, c.TargetTLS.CACertPath, filepath.Join(dir, "ca.key"), 3)
+	writeTestCert(t, c.TargetTLS.CertPath, c.TargetTLS.KeyPath, 4)
+	creds, err = c.transportCredentials(true)
+	assert.NoError(t, err)
+	assert.Equal(t, "tls", creds.Info().SecurityProtocol)
+	assert.Equal(t, "stratum", creds.Info().ServerName)
+}
+
+func TestController_PeerTransportCredentials(t *testing.T) {
+	c, _ := newTestController(t)
+	c.TargetTLS = TLSConfig{CACertPath: "/nonexistent/ca.crt"}
+
+	// Peers are connected to per the TLS parameters of our own gNMI service, not those of the Stratum connection
+	creds, err := c.peerTransportCredentials()
+	assert.NoError(t, err)
+	assert.Equal(t, "tls", creds.Info().SecurityProtocol)
+
+	c.PeerNoTLS = true
+	creds, err = c.peerTransportCredentials()
+	assert.NoError(t, err)
+	assert.Equal(t, "insecure", creds.Info().SecurityProtocol)
+
+	dir := t.TempDir()
+	c.PeerNoTLS = false
+	c.PeerTLS = TLSConfig{
+		CACertPath: filepath.Join(dir, "ca.crt"),
+		CertPath:   filepath.Join(dir, "client.crt"),
+		KeyPath:    filepath.Join(dir, "client.key"),
+	}
+	_, err = c.peerTransportCredentials()
+	assert.Error(t, err)
+
+	writeTestCert(t, c.PeerTLS.CACertPath, filepath.Join(dir, "ca.key"), 5)
+	writeTestCert(t, c.PeerTLS.CertPath, c.PeerTLS.KeyPath, 6)
+	creds, err = c.peerTransportCredentials()
+	assert.NoError(t, err)
+	assert.Equal(t, "tls", creds.Info().SecurityProtocol)
+	assert.NotNil(t, c.peerCertLoader)
+	assert.Nil(t, c.certLoader)
+}
+
+func TestTokenCredentials_Refresh(t *testing.T) {
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	creds := &tokenCredentials{tokenPath: tokenPath}
+	assert.True(t, creds.RequireTransportSecurity())
+
+	_, err := creds.GetRequestMetadata(context.Background())
+	assert.Error(t, err)
+
+	assert.NoError(t, os.WriteFile(tokenPath, []byte("  \n"), 0600))
+	_, err = creds.GetRequestMetadata(context.Background())
+	assert.Error(t, err)
+
+	// Token is re-read on each call, so that a refreshed token is picked up
+	assert.NoError(t, os.WriteFile(tokenPath, []byte("token1\n"), 0600))
+	md, err := creds.GetRequestMetadata(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer token1", md["authorization"])
+
+	assert.NoError(t, os.WriteFile(tokenPath, []byte("token2"), 0600))
+	md, err = creds.GetRequestMetadata(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer token2", md["authorization"])
+}
@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxVLANID   = 4094
+	maxVLANTags = 2
+	vlanTagLen  = 4
+	macAddrsLen = 12
+)
+
+// Returns the VLAN tags of the given packet, outermost first and separated by a dot, e.g. 100, or 100.200 if
+// double-tagged; empty if untagged
+func packetVLAN(rawPacket gopacket.Packet) string {
+	ids := make([]string, 0, maxVLANTags)
+	for _, layer := range rawPacket.Layers() {
+		if dot1q, ok := layer.(*layers.Dot1Q); ok {
+			ids = append(ids, strconv.FormatUint(uint64(dot1q.VLANIdentifier), 10))
+		}
+	}
+	return strings.Join(ids, ".")
+}
+
+// Returns the ethernet type and the payload of the given packet, following any VLAN tags
+func innerEthernetType(rawPacket gopacket.Packet) (layers.EthernetType, []byte) {
+	var ethType layers.EthernetType
+	var payload []byte
+	for _, layer := range rawPacket.Layers() {
+		switch l := layer.(type) {
+		case *layers.Ethernet:
+			ethType, payload = l.EthernetType, l.LayerPayload()
+		case *layers.Dot1Q:
+			ethType, payload = l.Type, l.LayerPayload()
+		}
+	}
+	return ethType, payload
+}
+
+// Parses the given VLAN tags, given in the form produced by packetVLAN
+func parseVLAN(vlan string) ([]uint16, error) {
+	if vlan == "" {
+		return nil, nil
+	}
+	fields := strings.Split(vlan, ".")
+	if len(fields) > maxVLANTags {
+		return nil, fmt.Errorf("too many VLAN tags: %s", vlan)
+	}
+	ids := make([]uint16, 0, len(fields))
+	for _, field := range fields {
+		id, err := strconv.ParseUint(field, 10, 16)
+		if err != nil || id < 1 || id > maxVLANID {
+			return nil, fmt.Errorf("invalid VLAN ID: %s", vlan)
+		}
+		ids = append(ids, uint16(id))
+	}
+	return ids, nil
+}
+
+// Returns the given ethernet frame with the given VLAN tags inserted after its MAC addresses; the outer tag of a
+// double-tagged frame uses the 802.1ad ethernet type
+func tagPacket(frame []byte, ids []uint16) []byte {
+	if len(ids) == 0 || len(frame) < macAddrsLen {
+		return frame
+	}
+	tagged := make([]byte, 0, len(frame)+len(ids)*vlanTagLen)
+	tagged = append(tagged, frame[:macAddrsLen]...)
+	for i, id := range ids {
+		ethType := layers.EthernetTypeDot1Q
+		if i == 0 && len(ids) > 1 {
+			ethType = layers.EthernetTypeQinQ
+		}
+		tagged = binary.BigEndian.AppendUint16(tagged, uint16(ethType))
+		tagged = binary.BigEndian.AppendUint16(tagged, id)
+	}
+	return append(tagged, frame[macAddrsLen:]...)
+}
+
+// Returns the VLANs on which tagged LLDP packets are to be emitted on the given port
+func (c *Controller) lldpVLANs(portNumber uint32) []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	for _, port := range c.config.LLDPVLANs {
+		if port.Port == portNumber {
+			return port.VLANs
+		}
+	}
+	return nil
+}
+
+// Returns the given VLAN formatted as a suffix of log messages; empty if untagged
+func vlanSuffix(vlan string) string {
+	if vlan == "" {
+		return ""
+	}
+	return " on VLAN " + vlan
+}
+
+// Returns the given VLANs of the given port without those that are not valid VLAN tags, which are logged
+func validLLDPVLANs(port uint32, vlans []string) []string {
+	valid := make([]string, 0, len(vlans))
+	for _, vlan := range vlans {
+		if _, err := parseVLAN(vlan); err != nil || vlan == "" {
+			log.Warnf("Ignoring invalid LLDP VLAN %q of port %d", vlan, port)
+			continue
+		}
+		valid = append(valid, vlan)
+	}
+	return valid
+}
@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2022-present Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/onosproject/onos-net-lib/pkg/configtree"
+	"github.com/openconfig/gnmi/proto/gnmi"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestVLANTags(t *testing.T) {
+	agent, _ := newTestController(t)
+	lldpBytes, err := agent.lldpPacket(3, 30, agent.nextProbeSequence())
+	assert.NoError(t, err)
+	bddpBytes, err := agent.bddpPacket(3, 30, agent.probeSequence)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "", packetVLAN(gopacket.NewPacket(lldpBytes, layers.LayerTypeEthernet, gopacket.Default)))
+	for _, vlan := range []string{"100", "100.200"} {
+		ids, err := parseVLAN(vlan)
+		assert.NoError(t, err)
+
+		packet := gopacket.NewPacket(tagPacket(lldpBytes, ids), layers.LayerTypeEthernet, gopacket.Default)
+		assert.Equal(t, vlan, packetVLAN(packet))
+		assert.NotNil(t, packet.Layer(layers.LayerTypeLinkLayerDiscovery))
+
+		packet = gopacket.NewPacket(tagPacket(bddpBytes, ids), layers.LayerTypeEthernet, gopacket.Default)
+		ethType, payload := innerEthernetType(packet)
+		assert.Equal(t, ethernetTypeBDDP, ethType)
+		assert.Equal(t, lldpBytes[14:], payload)
+	}
+
+	for _, vlan := range []string{"0", "4095", "abc", "1.2.3"} {
+		_, err := parseVLAN(vlan)
+		assert.Error(t, err)
+	}
+}
+
+func TestController_VLANLinks(t *testing.T) {
+	c, _ := newTestController(t)
+	neighbor, _ := newTestController(t)
+	neighbor.IngressDeviceID = "456"
+	lldpBytes, err := neighbor.lldpPacket(10, 30, neighbor.nextProbeSequence())
+	assert.NoError(t, err)
+
+	// Untagged and tagged LLDP packets of the same neighbor port are distinct links
+	c.processLLDPPacket(1, gopacket.NewPacket(lldpBytes, layers.LayerTypeEthernet, gopacket.Default))
+	c.processLLDPPacket(1, gopacket.NewPacket(tagPacket(lldpBytes, []uint16{100}), layers.LayerTypeEthernet, gopacket.Default))
+	assert.Len(t, c.GetLinks(), 2)
+	assert.NotNil(t, c.Root().GetPath("state/link[port=1,device=456,egress-port=10]/egress-device"))
+	assert.Equal(t, "456", c.Root().GetPath("state/link[port=1,device=456,egress-port=10,vlan=100]/egress-device").Value().GetStringVal())
+
+	// Tagged links are mirrored along with their VLAN
+	c.updateMastershipInTree(true)
+	_, links, _ := parseInventory(getInventory(t, c))
+	assert.Len(t, links, 2)
+	s, _ := newTestController(t)
+	s.mirrorInventory(links, nil)
+	assert.NotNil(t, s.Root().GetPath("state/link[port=1,device=456,egress-port=10,vlan=100]/egress-device"))
+}
+
+func TestController_VLANHosts(t *testing.T) {
+	c, _ := newTestController(t)
+	mac, otherMAC := "00:00:00:00:00:01", "00:00:00:00:00:02"
+
+	// The same MAC on different VLANs makes distinct hosts
+	c.processARPPacket(3, "100", newARP(layers.ARPRequest, mac, "10.0.0.1", "10.0.0.9"))
+	c.processARPPacket(4, "200", newARP(layers.ARPRequest, mac, "10.0.0.1", "10.0.0.9"))
+	assert.Len(t, c.hosts, 2)
+	assert.Equal(t, uint32(3), c.hosts[hostKey{mac: mac, vlan: "100"}].Port)
+	assert.Equal(t, int64(4), c.Root().GetPath("state/host[mac=00:00:00:00:00:01,vlan=200]/port").Value().GetIntVal())
+	assert.Nil(t, c.Root().GetPath("state/host[mac=00:00:00:00:00:01]"))
+
+	// The same address on different VLANs is not a conflict, whereas on the same VLAN it is
+	assert.Nil(t, c.Root().GetPath("state/host-events/event[seq=1]"))
+	c.processARPPacket(5, "100", newARP(layers.ARPRequest, otherMAC, "10.0.0.1", "10.0.0.9"))
+	assert.Equal(t, ipConflict, c.Root().GetPath("state/host-events/event[seq=1]/type").Value().GetStringVal())
+	assert.Equal(t, "100", c.Root().GetPath("state/host-events/event[seq=1]/vlan").Value().GetStringVal())
+	assert.Nil(t, c.Root().GetPath("state/host-events/event[seq=2]"))
+
+	// Tagged hosts are mirrored along with their VLAN
+	c.updateMastershipInTree(true)
+	_, _, hosts := parseInventory(getInventory(t, c))
+	assert.Len(t, hosts, 3)
+	s, _ := newTestController(t)
+	s.mirrorInventory(nil, hosts)
+	assert.Len(t, s.hosts, 3)
+	assert.Equal(t, []string{"10.0.0.1"}, s.hosts[hostKey{mac: mac, vlan: "200"}].IPs)
+
+	// Probes are tagged with the VLAN of the host
+	payload, err := hostProbePacket(hostKey{mac: mac, vlan: "200"}, "10.0.0.1")
+	assert.NoError(t, err)
+	packet := gopacket.NewPacket(payload, layers.LayerTypeEthernet, gopacket.Default)
+	assert.Equal(t, "200", packetVLAN(packet))
+	assert.NotNil(t, packet.Layer(layers.LayerTypeARP))
+}
+
+func TestGetLLDPVLANs(t *testing.T) {
+	root := configtree.NewRoot()
+	root.AddPath("config/lldp-vlans[port=2]", &gnmi.TypedValue{Value: &gnmi.TypedValue_StringVal{StringVal: "100, 100.200"}})
+	root.AddPath("config/lldp-vlans[port=1]", &gnmi.TypedValue{Value: &gnmi.TypedValue_StringVal{StringVal: "300"}})
+	root.AddPath("config/lldp-vlans[port=3]", &gnmi.TypedValue{Value: &gnmi.TypedValue_StringVal{StringVal: ""}})
+	assert.Equal(t, []PortVLANs{{Port: 1, VLANs: []string{"300"}}, {Port: 2, VLANs: []string{"100", "100.200"}}}, getLLDPVLANs(root))
+}
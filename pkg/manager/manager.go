@@ -21,9 +21,13 @@ var log = logging.GetLogger("manager")
 
 // Config is a manager configuration
 type Config struct {
-	AgentUUID     string
-	TargetAddress string
-	ServiceFlags  *cli.ServiceEndpointFlags
+	AgentUUID      string
+	TargetAddress  string
+	PeerAddresses  []string
+	PeerTokenPath  string
+	TargetTLS      discovery.TLSConfig
+	ServiceFlags   *cli.ServiceEndpointFlags
+	SecurityConfig northbound.SecurityConfig
 }
 
 // Manager is a single point of entry for the discovery-agent
@@ -55,10 +59,22 @@ func (m *Manager) Start() error {
 
 	// Initialize and start the link discovery controller
 	m.controller = discovery.NewController(m.Config.TargetAddress, m.Config.AgentUUID)
+	m.controller.PeerAddresses = m.Config.PeerAddresses
+	m.controller.PeerTokenPath = m.Config.PeerTokenPath
+	if m.Config.TargetTLS.Enabled() {
+		m.controller.TargetTLS = m.Config.TargetTLS
+	}
+	m.controller.PeerNoTLS = m.Config.ServiceFlags.NoTLS
+	m.controller.PeerTLS = discovery.TLSConfig{
+		CACertPath: m.Config.ServiceFlags.CAPath,
+		CertPath:   m.Config.ServiceFlags.CertPath,
+		KeyPath:    m.Config.ServiceFlags.KeyPath,
+	}
 	m.controller.Start()
 
-	// Starts NB server
-	s := northbound.NewServer(cli.ServerConfigFromFlags(m.Config.ServiceFlags, northbound.SecurityConfig{}))
+	// Starts NB server; unless --no-tls is given, it will require client certificates signed by the --ca-path CA,
+	// or by the default ONF CA; the security config only governs authentication of JWT bearer tokens
+	s := northbound.NewServer(cli.ServerConfigFromFlags(m.Config.ServiceFlags, m.Config.SecurityConfig))
 	s.AddService(logging.Service{})
 	s.AddService(gnmi.NewService(m.controller))
 	return s.StartInBackground()
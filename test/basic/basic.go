@@ -66,7 +66,7 @@ func (s *TestSuite) TestBasics(t *testing.T) {
 	err = subClient.Send(&gnmi.SubscribeRequest{
 		Request: &gnmi.SubscribeRequest_Subscribe{
 			Subscribe: &gnmi.SubscriptionList{
-				Subscription:     []*gnmi.Subscription{{Path: utils.ToPath("state/link[port=...]")}},
+				Subscription:     []*gnmi.Subscription{{Path: utils.ToPath("state/link[port=...,device=...,egress-port=...]")}},
 				Mode:             gnmi.SubscriptionList_STREAM,
 				AllowAggregation: true,
 				UpdatesOnly:      true,
@@ -84,7 +84,7 @@ func (s *TestSuite) TestBasics(t *testing.T) {
 	resp, err := subClient.Recv() // Now get the deletion notification
 	assert.NoError(t, err)
 	assert.Len(t, resp.GetUpdate().Delete, 1)
-	assert.Equal(t, "state/link[port=201]", utils.ToString(resp.GetUpdate().Delete[0]))
+	assert.Equal(t, "201", resp.GetUpdate().Delete[0].Elem[1].Key["port"])
 
 	// Now re-enable the spine1/1 port...
 	t.Log("Enabling port spine1/1...")
@@ -160,31 +160,43 @@ func ValidateLinkDiscovery(t *testing.T, id int) {
 	err = subClient.Send(&gnmi.SubscribeRequest{
 		Request: &gnmi.SubscribeRequest_Subscribe{
 			Subscribe: &gnmi.SubscriptionList{
-				Subscription:     []*gnmi.Subscription{{Path: utils.ToPath("state/link[port=...]")}},
+				Subscription:     []*gnmi.Subscription{{Path: utils.ToPath("state/link[port=...,device=...,egress-port=...]")}},
 				Mode:             gnmi.SubscriptionList_STREAM,
 				AllowAggregation: true,
 			}},
 	})
 	assert.NoError(t, err)
 
-	// Wait until we get 8 leaf updates total
-	for i := 0; i < 8; {
+	// Wait until we get updates for all 4 links
+	for i := 0; i < 4; {
 		sresp, err1 := subClient.Recv()
 		assert.NoError(t, err1)
-		i += len(sresp.GetUpdate().Update)
+		for _, update := range sresp.GetUpdate().Update {
+			if len(update.Path.Elem) == 3 && update.Path.Elem[2].Name == "egress-device" {
+				i++
+			}
+		}
 		//t.Logf("%d: Received update: %+v", id, sresp)
 	}
 
 	// Check basic queries to start
 	t.Logf("%d: Getting links via gNMI...", id)
 	resp, err := gnmiClient.Get(ctx, &gnmi.GetRequest{
-		Path: []*gnmi.Path{utils.ToPath("state/link[port=...]")},
+		Path: []*gnmi.Path{utils.ToPath("state/link[port=...,device=...,egress-port=...]")},
 	})
 	//t.Logf("%d: Received get response: %+v", id, resp)
 
 	assert.NoError(t, err)
 	assert.Len(t, resp.Notification, 1)
-	assert.Len(t, resp.Notification[0].Update, 4*3) // 4 links, with 2 leaves each
+
+	// Count the links by their egress device leaves, as links carry a varying number of neighbor detail leaves
+	links := 0
+	for _, update := range resp.Notification[0].Update {
+		if len(update.Path.Elem) == 3 && update.Path.Elem[2].Name == "egress-device" {
+			links++
+		}
+	}
+	assert.Equal(t, 4, links)
 }
 
 // CreateInsecureConnection creates gRPC connection to the specified gRPC end-point
@@ -223,8 +235,9 @@ func ValidateHostDiscovery(t *testing.T, id int) {
 	})
 	assert.NoError(t, err)
 
-	// Wait until we get 30 host updates (1 for port, 1 for IP address, 1 for create time)
-	for i := 0; i < 30; {
+	// Wait until we get 50 host updates (1 for port, 1 for create time, and 3 for the IP address: its family and
+	// create time, and the legacy IP address leaf)
+	for i := 0; i < 50; {
 		sresp, err1 := subClient.Recv()
 		assert.NoError(t, err1)
 		i += len(sresp.GetUpdate().Update)
@@ -240,5 +253,5 @@ func ValidateHostDiscovery(t *testing.T, id int) {
 
 	assert.NoError(t, err)
 	assert.Len(t, resp.Notification, 1)
-	assert.Len(t, resp.Notification[0].Update, 10*3) // 10 hosts per leaf in total, 3 notification per host
+	assert.Len(t, resp.Notification[0].Update, 10*5) // 10 hosts per leaf in total, 5 notification per host
 }